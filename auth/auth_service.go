@@ -1,84 +1,348 @@
 package auth
 
 import (
+	"context"
 	"errors"
+	"hello/mail"
 	"hello/models"
 	"hello/repositories"
+	"hello/services"
+	"log"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	errInvalidCredentials  = services.NewError(services.ErrUnauthorized, "invalid email or password")
+	errPasswordExpired     = services.NewError(services.ErrForbidden, "password has expired")
+	errInvalidRefreshToken = services.NewError(services.ErrUnauthorized, "invalid refresh token")
+	errRefreshTokenUsed    = services.NewError(services.ErrUnauthorized, "refresh token has already been used")
+)
+
+// dummyPasswordHash is compared against when the email is unknown, so that
+// logging in takes as long as for a registered account. It is hashed at
+// bcrypt.DefaultCost, like real passwords.
+const dummyPasswordHash = "$2a$10$8/jHOrELuGQhs97wfk2xZOtEAtucByUvcaP/i.Z7vixj1RII9yf8m"
+
 type AuthService struct {
-	userRepo   repositories.UserRepository
-	jwtManager *JWTManager
+	userRepo          repositories.UserRepository
+	roleRepo          repositories.RoleRepository
+	refreshRepo       repositories.RefreshTokenRepository
+	mfaRepo           repositories.MFARepository
+	resetRepo         repositories.PasswordResetRepository
+	verifyRepo        repositories.EmailVerificationRepository
+	revocations       RevocationStore
+	throttle          *LoginThrottle
+	passwords         *services.PasswordPolicy
+	audit             services.AuditService
+	mailer            mail.Mailer
+	jwtManager        *JWTManager
+	refreshExpiration time.Duration
+	mfaIssuer         string
+	baseURL           string
+	emailVerification string
 }
 
-func NewAuthService(userRepo repositories.UserRepository, jwtManager *JWTManager) *AuthService {
+func NewAuthService(userRepo repositories.UserRepository, roleRepo repositories.RoleRepository, refreshRepo repositories.RefreshTokenRepository, mfaRepo repositories.MFARepository, resetRepo repositories.PasswordResetRepository, verifyRepo repositories.EmailVerificationRepository, revocations RevocationStore, throttle *LoginThrottle, passwords *services.PasswordPolicy, audit services.AuditService, mailer mail.Mailer, jwtManager *JWTManager, refreshExpiration time.Duration, mfaIssuer, baseURL, emailVerification string) *AuthService {
 	return &AuthService{
-		userRepo:   userRepo,
-		jwtManager: jwtManager,
+		userRepo:          userRepo,
+		roleRepo:          roleRepo,
+		refreshRepo:       refreshRepo,
+		mfaRepo:           mfaRepo,
+		resetRepo:         resetRepo,
+		verifyRepo:        verifyRepo,
+		revocations:       revocations,
+		throttle:          throttle,
+		passwords:         passwords,
+		audit:             audit,
+		mailer:            mailer,
+		jwtManager:        jwtManager,
+		refreshExpiration: refreshExpiration,
+		mfaIssuer:         mfaIssuer,
+		baseURL:           strings.TrimSuffix(baseURL, "/"),
+		emailVerification: emailVerification,
 	}
 }
 
-func (s *AuthService) Login(email, password string) (*models.User, string, error) {
-	user, err := s.userRepo.FindByEmail(email)
+// Login checks the password. Users with two-factor authentication get an
+// MFA challenge token to pass to VerifyMFA instead of tokens. Repeated
+// failures for the email or from the IP are throttled.
+func (s *AuthService) Login(ctx context.Context, email, password, ip string) (*LoginResult, error) {
+	if err := s.throttle.check(ctx, email, ip); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByEmail(ctx, email)
 	if err != nil {
-		return nil, "", errors.New("invalid email or password")
+		if errors.Is(err, repositories.ErrNotFound) {
+			bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+			return nil, s.loginFailed(ctx, email, ip)
+		}
+		return nil, err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, "", errors.New("invalid email or password")
+		return nil, s.loginFailed(ctx, email, ip)
+	}
+	if s.emailVerification == EmailVerificationLogin && !user.EmailVerified() {
+		return nil, errEmailNotVerified
+	}
+	// The user has to choose a new password through ForgotPassword
+	if s.passwords.Expired(user) {
+		return nil, errPasswordExpired
+	}
+
+	enabled, err := s.mfaEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		token, err := s.createMFAChallenge(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{User: user, MFAToken: token, MFAExpiresIn: int64(mfaChallengeTTL.Seconds())}, nil
 	}
 
-	token, err := s.jwtManager.GenerateToken(user.ID, user.Email)
+	tokens, err := s.startSession(ctx, user)
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+	// Failures are only forgotten once the login is complete, so that
+	// guessing the second factor is throttled along with the password
+	if err := s.throttle.reset(ctx, email); err != nil {
+		return nil, err
 	}
+	return &LoginResult{User: user, Tokens: tokens}, nil
+}
 
-	return user, token, nil
+func (s *AuthService) loginFailed(ctx context.Context, email, ip string) error {
+	if err := s.throttle.failed(ctx, email, ip); err != nil {
+		return err
+	}
+	return errInvalidCredentials
 }
 
-func (s *AuthService) Register(name, email, password, phone string, age, status int) (*models.User, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// UnlockUser clears the failed logins recorded for a user's account. Blocks
+// on the IP addresses involved expire on their own.
+func (s *AuthService) UnlockUser(ctx context.Context, actor services.Actor, userID uint) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return services.MapNotFound(err, "user not found")
+	}
+
+	if err := s.throttle.reset(ctx, user.Email); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, actor, models.AuditActionUserUnlock, user.ID, user, user)
+	return nil
+}
+
+// startSession issues the first token pair of a new refresh token family.
+func (s *AuthService) startSession(ctx context.Context, user *models.User) (*TokenPair, error) {
+	familyID, err := generateOpaqueToken()
 	if err != nil {
 		return nil, err
 	}
+	return s.issueTokens(ctx, user, familyID)
+}
+
+// Refresh exchanges a refresh token for a new token pair. Each refresh token
+// is single-use: presenting one that was already rotated is treated as theft
+// and revokes every token descended from the same login.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	stored, err := s.refreshRepo.FindByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, errInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if stored.UsedAt != nil || stored.RevokedAt != nil {
+		if err := s.refreshRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, errRefreshTokenUsed
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, services.NewError(services.ErrUnauthorized, "refresh token has expired")
+	}
+
+	ok, err := s.refreshRepo.MarkUsed(ctx, stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := s.refreshRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, errRefreshTokenUsed
+	}
+
+	user, err := s.userRepo.FindByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, errInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, stored.FamilyID)
+}
+
+// Logout revokes the presented access token and, when supplied, the refresh
+// token family it was issued with.
+func (s *AuthService) Logout(ctx context.Context, jti string, expiresAt time.Time, refreshToken string) error {
+	if jti != "" {
+		if err := s.revocations.Revoke(ctx, jti, expiresAt); err != nil {
+			return err
+		}
+	}
 
+	if refreshToken == "" {
+		return nil
+	}
+
+	stored, err := s.refreshRepo.FindByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	return s.refreshRepo.RevokeFamily(ctx, stored.FamilyID)
+}
+
+// LogoutAll invalidates every access and refresh token issued to the user
+// up to now.
+func (s *AuthService) LogoutAll(ctx context.Context, userID uint) error {
+	if err := s.revocations.RevokeAllForUser(ctx, userID, time.Now().Truncate(time.Millisecond)); err != nil {
+		return err
+	}
+	return s.refreshRepo.RevokeAllForUser(ctx, userID)
+}
+
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, familyID string) (*TokenPair, error) {
+	accessToken, err := s.jwtManager.GenerateToken(user.ID, user.Email, user.RoleNames(), user.EmailVerified())
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := generateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.refreshRepo.Create(ctx, &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.refreshExpiration),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.jwtManager.Expiration().Seconds()),
+	}, nil
+}
+
+// Register creates an active account and mails a link to verify its email.
+func (s *AuthService) Register(ctx context.Context, actor services.Actor, name, email, password, phone string, age int) (*models.User, error) {
+	now := time.Now()
 	user := &models.User{
-		Name:     name,
-		Email:    email,
-		Password: string(hashedPassword),
-		Phone:    phone,
-		Age:      age,
-		Status:   status,
+		Name:              name,
+		Email:             email,
+		Phone:             phone,
+		Age:               age,
+		Status:            1,
+		PasswordChangedAt: &now,
+	}
+	if err := s.passwords.Check(ctx, user, "password", password); err != nil {
+		return nil, err
 	}
 
-	if err := s.userRepo.Create(user); err != nil {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
 		return nil, err
 	}
+	user.Password = string(hashedPassword)
+
+	if role, err := s.roleRepo.FindByName(ctx, models.RoleUser); err == nil {
+		user.Roles = []models.Role{*role}
+	}
 
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, services.MapDuplicateEmail(err)
+	}
+
+	// Self-registration is attributed to the new account itself
+	actor.UserID = user.ID
+	s.audit.Record(ctx, actor, models.AuditActionUserRegister, user.ID, nil, user)
+
+	// The account exists either way; the user can ask for another link
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		log.Printf("Failed to create email verification token for user %d: %v", user.ID, err)
+	}
 	return user, nil
 }
 
-func (s *AuthService) ChangePassword(userID uint, oldPassword, newPassword string) error {
-	user, err := s.userRepo.FindByID(userID)
+func (s *AuthService) ChangePassword(ctx context.Context, actor services.Actor, oldPassword, newPassword string) error {
+	user, err := s.userRepo.FindByID(ctx, actor.UserID)
 	if err != nil {
-		return errors.New("user not found")
+		return services.MapNotFound(err, "user not found")
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)); err != nil {
-		return errors.New("old password is incorrect")
+		return services.NewError(services.ErrValidation, "old password is incorrect")
+	}
+	if err := s.passwords.Check(ctx, user, "new_password", newPassword); err != nil {
+		return err
 	}
 
+	if err := s.savePassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, actor, models.AuditActionPasswordChange, user.ID, user, user)
+	return nil
+}
+
+// savePassword replaces the user's password, which must already have passed
+// the password policy, and adds the old one to the password history.
+func (s *AuthService) savePassword(ctx context.Context, user *models.User, newPassword string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
 
+	oldHash := user.Password
+	now := time.Now()
 	user.Password = string(hashedPassword)
-	return s.userRepo.Update(user)
+	user.PasswordChangedAt = &now
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+	return s.passwords.Remember(ctx, user.ID, oldHash)
+}
+
+// PasswordPolicy returns the rules new passwords must follow.
+func (s *AuthService) PasswordPolicy() services.PasswordPolicyConfig {
+	return s.passwords.Config()
 }
 
-func (s *AuthService) GetUserByID(userID uint) (*models.User, error) {
-	return s.userRepo.FindByID(userID)
+func (s *AuthService) GetUserByID(ctx context.Context, userID uint) (*models.User, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, services.MapNotFound(err, "user not found")
+	}
+	return user, nil
 }
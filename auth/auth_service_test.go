@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"hello/mail"
+	"hello/migrations"
+	"hello/models"
+	"hello/repositories"
+	"hello/services"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var ctx = context.Background()
+
+const testPassword = "correct horse battery"
+
+// openTestDB returns a migrated SQLite database that is removed after the
+// test.
+func openTestDB(t *testing.T) *gorm.DB {
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if _, err := migrations.NewMigrator(db).Up(0); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// newTestAuthService returns an AuthService on a fresh database. A nil
+// throttle allows 4 failures per account and 10 per IP, with a one minute
+// lockout.
+func newTestAuthService(t *testing.T, throttle *LoginThrottle) *AuthService {
+	db := openTestDB(t)
+	if throttle == nil {
+		throttle = NewLoginThrottle(NewMemoryLoginAttemptStore(), 4, 10, time.Minute)
+	}
+	passwords, err := services.NewPasswordPolicy(services.PasswordPolicyConfig{MinLength: 8}, repositories.NewPasswordHistoryRepository(db))
+	if err != nil {
+		t.Fatalf("password policy: %v", err)
+	}
+
+	return NewAuthService(
+		repositories.NewUserRepository(db),
+		repositories.NewRoleRepository(db),
+		repositories.NewRefreshTokenRepository(db),
+		repositories.NewMFARepository(db),
+		repositories.NewPasswordResetRepository(db),
+		repositories.NewEmailVerificationRepository(db),
+		NewMemoryRevocationStore(),
+		throttle,
+		passwords,
+		services.NewAuditService(repositories.NewAuditLogRepository(db)),
+		mail.NewMemoryMailer(),
+		NewJWTManager("test-secret", 15*time.Minute),
+		time.Hour,
+		"Test",
+		"http://localhost",
+		EmailVerificationOptional,
+	)
+}
+
+// createTestUser stores a user whose password is testPassword. The hash
+// uses the minimum cost to keep the tests fast.
+func createTestUser(t *testing.T, s *AuthService, email string) *models.User {
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	user := &models.User{Name: "Test User", Email: email, Password: string(hash), Status: 1}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		t.Fatalf("create %s: %v", email, err)
+	}
+	return user
+}
+
+func login(t *testing.T, s *AuthService, email string) *TokenPair {
+	result, err := s.Login(ctx, email, testPassword, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("login %s: %v", email, err)
+	}
+	if result.Tokens == nil {
+		t.Fatalf("login %s: no tokens", email)
+	}
+	return result.Tokens
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	s := newTestAuthService(t, nil)
+	createTestUser(t, s, "alice@example.com")
+	first := login(t, s, "alice@example.com")
+
+	second, err := s.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh returned the same refresh token")
+	}
+	if _, err := s.jwtManager.VerifyToken(second.AccessToken); err != nil {
+		t.Fatalf("new access token is invalid: %v", err)
+	}
+
+	third, err := s.Refresh(ctx, second.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh the rotated token: %v", err)
+	}
+
+	storedFirst, _ := s.refreshRepo.FindByHash(ctx, hashToken(first.RefreshToken))
+	storedThird, _ := s.refreshRepo.FindByHash(ctx, hashToken(third.RefreshToken))
+	if storedFirst.FamilyID != storedThird.FamilyID {
+		t.Fatalf("family = %q, want the login's %q", storedThird.FamilyID, storedFirst.FamilyID)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	tests := []struct {
+		name string
+		// reuse presents a token of the family after it was rotated and
+		// returns the current one
+		reuse func(t *testing.T, s *AuthService, first, current *TokenPair)
+	}{
+		{"first token reused", func(t *testing.T, s *AuthService, first, current *TokenPair) {
+			if _, err := s.Refresh(ctx, first.RefreshToken); !errors.Is(err, errRefreshTokenUsed) {
+				t.Fatalf("reuse: err = %v, want errRefreshTokenUsed", err)
+			}
+		}},
+		{"current token refreshed twice", func(t *testing.T, s *AuthService, first, current *TokenPair) {
+			if _, err := s.Refresh(ctx, current.RefreshToken); err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+			if _, err := s.Refresh(ctx, current.RefreshToken); !errors.Is(err, errRefreshTokenUsed) {
+				t.Fatalf("second refresh: err = %v, want errRefreshTokenUsed", err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestAuthService(t, nil)
+			createTestUser(t, s, "alice@example.com")
+			other := login(t, s, "alice@example.com")
+
+			first := login(t, s, "alice@example.com")
+			current, err := s.Refresh(ctx, first.RefreshToken)
+			if err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+
+			tt.reuse(t, s, first, current)
+
+			// The legitimate holder's latest token is revoked with the family
+			if _, err := s.Refresh(ctx, current.RefreshToken); !errors.Is(err, errRefreshTokenUsed) {
+				t.Fatalf("refresh after reuse: err = %v, want errRefreshTokenUsed", err)
+			}
+			// Sessions from other logins are not affected
+			if _, err := s.Refresh(ctx, other.RefreshToken); err != nil {
+				t.Fatalf("refresh another session: %v", err)
+			}
+		})
+	}
+}
+
+func TestRefreshRejectsInvalidTokens(t *testing.T) {
+	s := newTestAuthService(t, nil)
+	user := createTestUser(t, s, "alice@example.com")
+
+	expired := "expired-refresh-token"
+	err := s.refreshRepo.Create(ctx, &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  "expired-family",
+		TokenHash: hashToken(expired),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("create expired token: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown", "no-such-token"},
+		{"empty", ""},
+		{"expired", expired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Refresh(ctx, tt.token)
+			if !errors.Is(err, services.ErrUnauthorized) {
+				t.Fatalf("err = %v, want ErrUnauthorized", err)
+			}
+		})
+	}
+}
+
+func TestLogoutRevokesFamily(t *testing.T) {
+	s := newTestAuthService(t, nil)
+	createTestUser(t, s, "alice@example.com")
+	first := login(t, s, "alice@example.com")
+	current, err := s.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	// A client whose refresh raced the logout may still hold the older token
+	if err := s.Logout(ctx, "", time.Time{}, first.RefreshToken); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if _, err := s.Refresh(ctx, current.RefreshToken); !errors.Is(err, errRefreshTokenUsed) {
+		t.Fatalf("refresh after logout: err = %v, want errRefreshTokenUsed", err)
+	}
+}
+
+func TestLogoutAllKeepsLaterLogins(t *testing.T) {
+	s := newTestAuthService(t, nil)
+	user := createTestUser(t, s, "alice@example.com")
+	before := login(t, s, "alice@example.com")
+
+	if err := s.LogoutAll(ctx, user.ID); err != nil {
+		t.Fatalf("logout all: %v", err)
+	}
+	// Usually within the same second as the cutoff
+	time.Sleep(2 * time.Millisecond)
+	after := login(t, s, "alice@example.com")
+
+	tests := []struct {
+		name    string
+		token   string
+		revoked bool
+	}{
+		{"issued before", before.AccessToken, true},
+		{"issued after", after.AccessToken, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := s.jwtManager.VerifyToken(tt.token)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			revoked, err := IsTokenRevoked(ctx, s.revocations, claims)
+			if err != nil {
+				t.Fatalf("is revoked: %v", err)
+			}
+			if revoked != tt.revoked {
+				t.Fatalf("revoked = %v, want %v", revoked, tt.revoked)
+			}
+		})
+	}
+}
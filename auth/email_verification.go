@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hello/mail"
+	"hello/models"
+	"hello/repositories"
+	"hello/services"
+	"log"
+	"time"
+)
+
+// Email verification modes, chosen by configuration. Verification links are
+// mailed in every mode; the modes differ in what an unverified user can do.
+const (
+	// EmailVerificationOptional lets unverified users do everything.
+	EmailVerificationOptional = "optional"
+	// EmailVerificationLogin refuses to log in unverified users.
+	EmailVerificationLogin = "login"
+	// EmailVerificationRestricted logs unverified users in but limits them
+	// to managing their session; see middleware.RequireVerifiedEmail.
+	EmailVerificationRestricted = "restricted"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+
+	// A user gets at most one verification email per interval and
+	// verificationHourlyLimit per hour
+	verificationResendInterval = time.Minute
+	verificationHourlyLimit    = 5
+)
+
+var (
+	errEmailNotVerified         = services.NewError(services.ErrForbidden, "email address is not verified")
+	errInvalidVerificationToken = services.NewError(services.ErrValidation, "invalid or expired verification token")
+)
+
+func (s *AuthService) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = s.verifyRepo.Create(ctx, &models.EmailVerificationToken{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "验证邮箱",
+		Body: fmt.Sprintf("%s，您好：\n\n请在 %d 小时内打开以下链接验证您的邮箱：\n\n%s/verify-email?token=%s\n\n如果您没有注册账号，请忽略此邮件。\n",
+			user.Name, int(emailVerificationTTL.Hours()), s.baseURL, token),
+	}
+	go s.sendMail(context.WithoutCancel(ctx), msg, user.ID)
+	return nil
+}
+
+// VerifyEmail marks the user's email as verified with a token from a
+// verification email. Following a link again is not an error.
+func (s *AuthService) VerifyEmail(ctx context.Context, actor services.Actor, token string) error {
+	stored, err := s.verifyRepo.FindByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return errInvalidVerificationToken
+		}
+		return err
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return errInvalidVerificationToken
+	}
+
+	user, err := s.userRepo.FindByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return errInvalidVerificationToken
+		}
+		return err
+	}
+	// The link verifies the address it was sent to, not a later one
+	if user.Email != stored.Email {
+		return errInvalidVerificationToken
+	}
+	if user.EmailVerified() {
+		return nil
+	}
+
+	ok, err := s.verifyRepo.MarkUsed(ctx, stored.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidVerificationToken
+	}
+
+	before := *user
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+
+	// Verification is attributed to the account itself
+	actor.UserID = user.ID
+	s.audit.Record(ctx, actor, models.AuditActionEmailVerify, user.ID, &before, user)
+	return nil
+}
+
+// ResendVerification mails a new verification link. Like ForgotPassword it
+// succeeds whether or not the email belongs to an unverified account, and
+// requests over the per-user limits are dropped without telling the caller.
+func (s *AuthService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.EmailVerified() {
+		return nil
+	}
+
+	now := time.Now()
+	recent, err := s.verifyRepo.CountCreatedSince(ctx, user.ID, now.Add(-verificationResendInterval))
+	if err != nil {
+		return err
+	}
+	hourly, err := s.verifyRepo.CountCreatedSince(ctx, user.ID, now.Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if recent > 0 || hourly >= verificationHourlyLimit {
+		log.Printf("Throttled verification email for user %d", user.ID)
+		return nil
+	}
+
+	return s.sendVerificationEmail(ctx, user)
+}
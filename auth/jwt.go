@@ -8,16 +8,37 @@ import (
 )
 
 type JWTManager struct {
-	secretKey string
+	secretKey  string
 	expiration time.Duration
 }
 
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
+	UserID uint     `json:"user_id"`
+	Email  string   `json:"email"`
+	Roles  []string `json:"roles"`
+	// EmailVerified is false in tokens issued before the user verified their
+	// email; refreshing after verification picks up the change.
+	EmailVerified bool `json:"email_verified"`
+	// IssuedAtMs is the issue time in Unix milliseconds. The standard iat
+	// claim has whole seconds, too coarse for a "log out all sessions"
+	// cutoff to tell apart tokens issued just before it from logins made in
+	// the same second afterwards.
+	IssuedAtMs int64 `json:"iat_ms,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// issuedAt returns when the token was issued, to the millisecond when the
+// token says so, or the zero time when it does not say.
+func (c *Claims) issuedAt() time.Time {
+	if c.IssuedAtMs != 0 {
+		return time.UnixMilli(c.IssuedAtMs)
+	}
+	if c.IssuedAt != nil {
+		return c.IssuedAt.Time
+	}
+	return time.Time{}
+}
+
 func NewJWTManager(secretKey string, expiration time.Duration) *JWTManager {
 	return &JWTManager{
 		secretKey:  secretKey,
@@ -25,13 +46,27 @@ func NewJWTManager(secretKey string, expiration time.Duration) *JWTManager {
 	}
 }
 
-func (m *JWTManager) GenerateToken(userID uint, email string) (string, error) {
+func (m *JWTManager) Expiration() time.Duration {
+	return m.expiration
+}
+
+func (m *JWTManager) GenerateToken(userID uint, email string, roles []string, emailVerified bool) (string, error) {
+	jti, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:        userID,
+		Email:         email,
+		Roles:         roles,
+		EmailVerified: emailVerified,
+		IssuedAtMs:    now.UnixMilli(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.expiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.expiration)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"hello/models"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttemptStore counts failed logins per key. Counts that have seen no
+// failure for window, and are not locked, are forgotten.
+type LoginAttemptStore interface {
+	// Get returns the attempts recorded for key, or nil if there are none.
+	Get(ctx context.Context, key string) (*models.LoginAttempt, error)
+	// RecordFailure counts a failed login and returns the new count.
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+func attemptExpired(attempt *models.LoginAttempt, now time.Time, window time.Duration) bool {
+	if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+		return false
+	}
+	return attempt.LastFailureAt.Before(now.Add(-window))
+}
+
+type memoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]*models.LoginAttempt
+}
+
+func NewMemoryLoginAttemptStore() LoginAttemptStore {
+	return &memoryLoginAttemptStore{attempts: make(map[string]*models.LoginAttempt)}
+}
+
+func (s *memoryLoginAttemptStore) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	copied := *attempt
+	return &copied, nil
+}
+
+func (s *memoryLoginAttemptStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, attempt := range s.attempts {
+		if attemptExpired(attempt, now, window) {
+			delete(s.attempts, k)
+		}
+	}
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &models.LoginAttempt{Key: key}
+		s.attempts[key] = attempt
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	return attempt.Failures, nil
+}
+
+func (s *memoryLoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attempt, ok := s.attempts[key]; ok {
+		attempt.LockedUntil = &until
+	}
+	return nil
+}
+
+func (s *memoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+type dbLoginAttemptStore struct {
+	db *gorm.DB
+}
+
+func NewDBLoginAttemptStore(db *gorm.DB) LoginAttemptStore {
+	return &dbLoginAttemptStore{db: db}
+}
+
+func (s *dbLoginAttemptStore) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := s.db.WithContext(ctx).Where("attempt_key = ?", key).First(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (s *dbLoginAttemptStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+	err := db.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-window), now).
+		Delete(&models.LoginAttempt{}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	// Increment in place so concurrent failures are all counted. If the row
+	// does not exist yet, insert it; should another request insert it first,
+	// the second increment applies to that row.
+	for i := 0; i < 2; i++ {
+		result := db.Model(&models.LoginAttempt{}).Where("attempt_key = ?", key).Updates(map[string]interface{}{
+			"failures":        gorm.Expr("failures + 1"),
+			"last_failure_at": now,
+		})
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected > 0 {
+			break
+		}
+
+		attempt := &models.LoginAttempt{Key: key, Failures: 1, LastFailureAt: now}
+		result = db.Clauses(clause.OnConflict{DoNothing: true}).Create(attempt)
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return 1, nil
+		}
+	}
+
+	attempt, err := s.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if attempt == nil {
+		return 0, errors.New("login attempt disappeared while being recorded")
+	}
+	return attempt.Failures, nil
+}
+
+func (s *dbLoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.LoginAttempt{}).Where("attempt_key = ?", key).Update("locked_until", until).Error
+}
+
+func (s *dbLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Where("attempt_key = ?", key).Delete(&models.LoginAttempt{}).Error
+}
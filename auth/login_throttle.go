@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"hello/services"
+	"strings"
+	"time"
+)
+
+// The first backoff delay; each further failure doubles it.
+const loginBackoffBase = time.Second
+
+// LoginThrottle slows down password guessing. Failed logins are counted per
+// account and per client IP. Once a count passes half its limit, each
+// further failure blocks that account or IP for twice as long as the one
+// before; reaching the limit locks it for the lockout duration. Counts are
+// forgotten a lockout duration after the last failure.
+//
+// Accounts are keyed by the email as typed, whether or not it is
+// registered, so responses do not reveal which accounts exist.
+type LoginThrottle struct {
+	store              LoginAttemptStore
+	maxAccountFailures int // 0 disables per-account throttling
+	maxIPFailures      int // 0 disables per-IP throttling
+	lockout            time.Duration
+}
+
+func NewLoginThrottle(store LoginAttemptStore, maxAccountFailures, maxIPFailures int, lockout time.Duration) *LoginThrottle {
+	return &LoginThrottle{
+		store:              store,
+		maxAccountFailures: maxAccountFailures,
+		maxIPFailures:      maxIPFailures,
+		lockout:            lockout,
+	}
+}
+
+type throttleKey struct {
+	key         string
+	maxFailures int
+}
+
+func (t *LoginThrottle) keys(email, ip string) []throttleKey {
+	var keys []throttleKey
+	if t.maxAccountFailures > 0 {
+		keys = append(keys, throttleKey{accountKey(email), t.maxAccountFailures})
+	}
+	if t.maxIPFailures > 0 && ip != "" {
+		keys = append(keys, throttleKey{"ip:" + ip, t.maxIPFailures})
+	}
+	return keys
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// check refuses the attempt while the account or the IP is blocked.
+func (t *LoginThrottle) check(ctx context.Context, email, ip string) error {
+	now := time.Now()
+	var wait time.Duration
+	for _, k := range t.keys(email, ip) {
+		attempt, err := t.store.Get(ctx, k.key)
+		if err != nil {
+			return err
+		}
+		if attempt != nil && attempt.LockedUntil != nil {
+			wait = max(wait, attempt.LockedUntil.Sub(now))
+		}
+	}
+	if wait <= 0 {
+		return nil
+	}
+	return &services.Error{
+		Kind:       services.ErrRateLimited,
+		Message:    "too many failed login attempts, try again later",
+		RetryAfter: wait,
+	}
+}
+
+// failed counts a failed login and blocks the keys that reached a delay.
+func (t *LoginThrottle) failed(ctx context.Context, email, ip string) error {
+	now := time.Now()
+	for _, k := range t.keys(email, ip) {
+		failures, err := t.store.RecordFailure(ctx, k.key, t.lockout)
+		if err != nil {
+			return err
+		}
+		if delay := t.delay(failures, k.maxFailures); delay > 0 {
+			if err := t.store.Lock(ctx, k.key, now.Add(delay)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// delay returns how long a key is blocked after its nth failure.
+func (t *LoginThrottle) delay(failures, maxFailures int) time.Duration {
+	if failures >= maxFailures {
+		return t.lockout
+	}
+	free := maxFailures / 2
+	if failures <= free {
+		return 0
+	}
+	if n := failures - free - 1; n < 32 {
+		if d := loginBackoffBase << n; d < t.lockout {
+			return d
+		}
+	}
+	return t.lockout
+}
+
+// reset clears the account's failures, after a successful login or when an
+// administrator unlocks it. Failures from the IP are kept, so that logging
+// in to one account does not reset guessing against others.
+func (t *LoginThrottle) reset(ctx context.Context, email string) error {
+	return t.store.Reset(ctx, accountKey(email))
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"errors"
+	"hello/services"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleDelay(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxFailures int
+		lockout     time.Duration
+		failures    int
+		want        time.Duration
+	}{
+		{"first failure", 6, time.Hour, 1, 0},
+		{"half the limit", 6, time.Hour, 3, 0},
+		{"first delay", 6, time.Hour, 4, time.Second},
+		{"delay doubles", 6, time.Hour, 5, 2 * time.Second},
+		{"limit reached", 6, time.Hour, 6, time.Hour},
+		{"past the limit", 6, time.Hour, 9, time.Hour},
+		{"long backoff", 40, time.Hour, 30, 512 * time.Second},
+		{"delay capped at lockout", 40, time.Minute, 30, time.Minute},
+		{"shift does not overflow", 200, time.Hour, 199, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := NewLoginThrottle(NewMemoryLoginAttemptStore(), tt.maxFailures, tt.maxFailures, tt.lockout)
+			if got := throttle.delay(tt.failures, tt.maxFailures); got != tt.want {
+				t.Fatalf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleBlocksForGrowingDelays(t *testing.T) {
+	store := NewMemoryLoginAttemptStore()
+	throttle := NewLoginThrottle(store, 8, 0, time.Hour)
+	key := accountKey("alice@example.com")
+
+	var previous time.Duration
+	for i := 1; i <= 8; i++ {
+		start := time.Now()
+		if err := throttle.failed(ctx, "alice@example.com", ""); err != nil {
+			t.Fatalf("failure %d: %v", i, err)
+		}
+		attempt, err := store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+
+		var blocked time.Duration
+		if attempt.LockedUntil != nil {
+			blocked = attempt.LockedUntil.Sub(start)
+		}
+		if i <= 4 && blocked != 0 {
+			t.Fatalf("failure %d: blocked for %v, want no delay", i, blocked)
+		}
+		if i > 4 && blocked <= previous {
+			t.Fatalf("failure %d: blocked for %v, want longer than %v", i, blocked, previous)
+		}
+		previous = blocked
+	}
+	if previous < time.Hour-time.Second {
+		t.Fatalf("blocked for %v at the limit, want the lockout", previous)
+	}
+}
+
+func TestLoginLocksOutAccount(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+	}{
+		{"registered account", "alice@example.com"},
+		{"unknown account", "nobody@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestAuthService(t, NewLoginThrottle(NewMemoryLoginAttemptStore(), 2, 0, time.Minute))
+			createTestUser(t, s, "alice@example.com")
+
+			for i := 0; i < 2; i++ {
+				if _, err := s.Login(ctx, tt.email, "wrong password", "192.0.2.1"); !errors.Is(err, errInvalidCredentials) {
+					t.Fatalf("failure %d: err = %v, want errInvalidCredentials", i+1, err)
+				}
+			}
+
+			// Locked even for the right password, and from another IP
+			_, err := s.Login(ctx, tt.email, testPassword, "192.0.2.2")
+			var domainErr *services.Error
+			if !errors.As(err, &domainErr) || !errors.Is(err, services.ErrRateLimited) {
+				t.Fatalf("err = %v, want ErrRateLimited", err)
+			}
+			if domainErr.RetryAfter <= 0 || domainErr.RetryAfter > time.Minute {
+				t.Fatalf("retry after = %v, want up to the one minute lockout", domainErr.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestLoginLocksOutIP(t *testing.T) {
+	s := newTestAuthService(t, NewLoginThrottle(NewMemoryLoginAttemptStore(), 0, 2, time.Minute))
+	createTestUser(t, s, "alice@example.com")
+
+	for _, email := range []string{"bob@example.com", "carol@example.com"} {
+		if _, err := s.Login(ctx, email, "wrong password", "192.0.2.1"); !errors.Is(err, errInvalidCredentials) {
+			t.Fatalf("%s: err = %v, want errInvalidCredentials", email, err)
+		}
+	}
+	if _, err := s.Login(ctx, "alice@example.com", testPassword, "192.0.2.1"); !errors.Is(err, services.ErrRateLimited) {
+		t.Fatalf("same IP: err = %v, want ErrRateLimited", err)
+	}
+	if _, err := s.Login(ctx, "alice@example.com", testPassword, "192.0.2.2"); err != nil {
+		t.Fatalf("other IP: %v", err)
+	}
+}
+
+func TestLoginSuccessResetsAccountFailures(t *testing.T) {
+	store := NewMemoryLoginAttemptStore()
+	s := newTestAuthService(t, NewLoginThrottle(store, 4, 10, time.Minute))
+	createTestUser(t, s, "alice@example.com")
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Login(ctx, "alice@example.com", "wrong password", "192.0.2.1"); !errors.Is(err, errInvalidCredentials) {
+			t.Fatalf("failure %d: err = %v, want errInvalidCredentials", i+1, err)
+		}
+	}
+	login(t, s, "alice@example.com")
+
+	if attempt, _ := store.Get(ctx, accountKey("alice@example.com")); attempt != nil {
+		t.Fatalf("account failures = %d after a successful login, want none", attempt.Failures)
+	}
+	// Failures from the IP still count against guessing other accounts
+	if attempt, _ := store.Get(ctx, "ip:192.0.2.1"); attempt == nil || attempt.Failures != 2 {
+		t.Fatalf("IP attempts = %+v, want 2 failures", attempt)
+	}
+}
+
+func TestUnlockUserClearsLockout(t *testing.T) {
+	s := newTestAuthService(t, NewLoginThrottle(NewMemoryLoginAttemptStore(), 2, 0, time.Hour))
+	user := createTestUser(t, s, "Alice@Example.com")
+
+	for i := 0; i < 2; i++ {
+		s.Login(ctx, "alice@example.com", "wrong password", "192.0.2.1")
+	}
+	if _, err := s.Login(ctx, user.Email, testPassword, "192.0.2.1"); !errors.Is(err, services.ErrRateLimited) {
+		t.Fatalf("before unlock: err = %v, want ErrRateLimited", err)
+	}
+
+	if err := s.UnlockUser(ctx, services.Actor{UserID: user.ID}, user.ID); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	login(t, s, user.Email)
+}
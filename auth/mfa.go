@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"hello/models"
+	"hello/repositories"
+	"hello/services"
+	"strings"
+	"time"
+)
+
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+)
+
+var (
+	errInvalidMFAToken   = services.NewError(services.ErrUnauthorized, "invalid or expired MFA token")
+	errInvalidMFACode    = services.NewError(services.ErrUnauthorized, "invalid verification code")
+	errMFAAlreadyEnabled = services.NewError(services.ErrConflict, "two-factor authentication is already enabled")
+	errMFANotPending     = services.NewError(services.ErrConflict, "two-factor enrollment has not been started")
+)
+
+// MFAEnrollment is a pending TOTP enrollment. URI is the otpauth:// URI to
+// show as a QR code; Secret is for entering the key by hand.
+type MFAEnrollment struct {
+	Secret string
+	URI    string
+}
+
+type MFAStatus struct {
+	Enabled                bool
+	RecoveryCodesRemaining int64
+}
+
+func (s *AuthService) mfaEnabled(ctx context.Context, userID uint) (bool, error) {
+	secret, err := s.mfaRepo.FindSecret(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return secret.Enabled(), nil
+}
+
+func (s *AuthService) createMFAChallenge(ctx context.Context, userID uint) (string, error) {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.mfaRepo.CreateChallenge(ctx, &models.MFAChallenge{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// VerifyMFA completes a login started by Login with a TOTP or recovery code.
+// A challenge allows a few attempts and yields at most one token pair. Wrong
+// codes count as failed logins for the account and the IP, like wrong
+// passwords.
+func (s *AuthService) VerifyMFA(ctx context.Context, mfaToken, code, ip string) (*models.User, *TokenPair, error) {
+	challenge, err := s.mfaRepo.FindChallengeByHash(ctx, hashToken(mfaToken))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, nil, errInvalidMFAToken
+		}
+		return nil, nil, err
+	}
+	if time.Now().After(challenge.ExpiresAt) {
+		return nil, nil, errInvalidMFAToken
+	}
+
+	user, err := s.userRepo.FindByID(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, nil, errInvalidMFAToken
+		}
+		return nil, nil, err
+	}
+	if err := s.throttle.check(ctx, user.Email, ip); err != nil {
+		return nil, nil, err
+	}
+
+	ok, err := s.mfaRepo.RecordChallengeAttempt(ctx, challenge.ID, mfaChallengeMaxAttempts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, errInvalidMFAToken
+	}
+
+	// The enrollment may have been reset since the password step
+	secret, err := s.mfaRepo.FindSecret(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, nil, errInvalidMFAToken
+		}
+		return nil, nil, err
+	}
+	if !secret.Enabled() {
+		return nil, nil, errInvalidMFAToken
+	}
+
+	ok, err = s.useSecondFactor(ctx, secret, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		if err := s.throttle.failed(ctx, user.Email, ip); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errInvalidMFACode
+	}
+
+	ok, err = s.mfaRepo.MarkChallengeUsed(ctx, challenge.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, errInvalidMFAToken
+	}
+
+	tokens, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.throttle.reset(ctx, user.Email); err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// useSecondFactor consumes code, which is either a TOTP code that was not
+// used before or an unused recovery code.
+func (s *AuthService) useSecondFactor(ctx context.Context, secret *models.MFASecret, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		step, ok := matchTOTP(secret.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return s.mfaRepo.UseStep(ctx, secret.UserID, step)
+	}
+	return s.mfaRepo.UseRecoveryCode(ctx, secret.UserID, hashToken(normalizeRecoveryCode(code)))
+}
+
+// EnrollMFA starts a TOTP enrollment for the actor, replacing any pending
+// one. It takes effect once confirmed with ConfirmMFA.
+func (s *AuthService) EnrollMFA(ctx context.Context, actor services.Actor) (*MFAEnrollment, error) {
+	user, err := s.userRepo.FindByID(ctx, actor.UserID)
+	if err != nil {
+		return nil, services.MapNotFound(err, "user not found")
+	}
+
+	enabled, err := s.mfaEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, errMFAAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.SaveSecret(ctx, &models.MFASecret{UserID: user.ID, Secret: secret}); err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    totpURI(s.mfaIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmMFA enables the actor's pending enrollment once they prove it works
+// with a code from their authenticator. It returns the recovery codes, which
+// are only stored hashed and cannot be shown again.
+func (s *AuthService) ConfirmMFA(ctx context.Context, actor services.Actor, code string) ([]string, error) {
+	user, err := s.userRepo.FindByID(ctx, actor.UserID)
+	if err != nil {
+		return nil, services.MapNotFound(err, "user not found")
+	}
+
+	secret, err := s.mfaRepo.FindSecret(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, errMFANotPending
+		}
+		return nil, err
+	}
+	if secret.Enabled() {
+		return nil, errMFAAlreadyEnabled
+	}
+
+	step, ok := matchTOTP(secret.Secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return nil, services.NewError(services.ErrValidation, "invalid verification code")
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = hashToken(normalizeRecoveryCode(c))
+	}
+
+	if err := s.mfaRepo.Confirm(ctx, user.ID, step, hashes); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, errMFANotPending
+		}
+		return nil, err
+	}
+
+	s.audit.Record(ctx, actor, models.AuditActionMFAEnable, user.ID, user, user)
+	return codes, nil
+}
+
+func (s *AuthService) GetMFAStatus(ctx context.Context, userID uint) (*MFAStatus, error) {
+	enabled, err := s.mfaEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return &MFAStatus{}, nil
+	}
+
+	remaining, err := s.mfaRepo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAStatus{Enabled: true, RecoveryCodesRemaining: remaining}, nil
+}
+
+// ResetMFA removes a user's enrollment, for when they lost their
+// authenticator and recovery codes. They log in with the password alone
+// until they enroll again.
+func (s *AuthService) ResetMFA(ctx context.Context, actor services.Actor, userID uint) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return services.MapNotFound(err, "user not found")
+	}
+
+	if _, err := s.mfaRepo.FindSecret(ctx, userID); err != nil {
+		return services.MapNotFound(err, "two-factor authentication is not set up for this user")
+	}
+	if err := s.mfaRepo.Delete(ctx, userID); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, actor, models.AuditActionMFAReset, user.ID, user, user)
+	return nil
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"hello/services"
+	"testing"
+	"time"
+)
+
+// enableTestMFA turns on two-factor authentication for user, confirming it
+// with the code of the previous time step so the current one is unused. It
+// returns the key to compute codes with.
+func enableTestMFA(t *testing.T, s *AuthService, userID uint) []byte {
+	actor := services.Actor{UserID: userID}
+	enrollment, err := s.EnrollMFA(ctx, actor)
+	if err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	if _, err := s.ConfirmMFA(ctx, actor, totpCode(key, totpStep(time.Now())-1)); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	return key
+}
+
+// startMFALogin logs in with the password and returns the MFA challenge
+// token.
+func startMFALogin(t *testing.T, s *AuthService, email string) string {
+	result, err := s.Login(ctx, email, testPassword, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if result.MFAToken == "" || result.Tokens != nil {
+		t.Fatalf("login returned %+v, want an MFA challenge", result)
+	}
+	return result.MFAToken
+}
+
+func TestVerifyMFARejectsReplayedCode(t *testing.T) {
+	s := newTestAuthService(t, nil)
+	user := createTestUser(t, s, "alice@example.com")
+	key := enableTestMFA(t, s, user.ID)
+	code := totpCode(key, totpStep(time.Now()))
+
+	if _, tokens, err := s.VerifyMFA(ctx, startMFALogin(t, s, user.Email), code, "192.0.2.1"); err != nil || tokens == nil {
+		t.Fatalf("verify: tokens = %v, err = %v", tokens, err)
+	}
+	if _, _, err := s.VerifyMFA(ctx, startMFALogin(t, s, user.Email), code, "192.0.2.1"); !errors.Is(err, errInvalidMFACode) {
+		t.Fatalf("replayed code: err = %v, want errInvalidMFACode", err)
+	}
+	// So is the code of the step used to confirm the enrollment
+	previous := totpCode(key, totpStep(time.Now())-1)
+	if _, _, err := s.VerifyMFA(ctx, startMFALogin(t, s, user.Email), previous, "192.0.2.1"); !errors.Is(err, errInvalidMFACode) {
+		t.Fatalf("confirmation code: err = %v, want errInvalidMFACode", err)
+	}
+}
+
+func TestVerifyMFAChallengeAllowsOneSuccess(t *testing.T) {
+	s := newTestAuthService(t, nil)
+	user := createTestUser(t, s, "alice@example.com")
+	key := enableTestMFA(t, s, user.ID)
+	mfaToken := startMFALogin(t, s, user.Email)
+
+	if _, _, err := s.VerifyMFA(ctx, mfaToken, totpCode(key, totpStep(time.Now())), "192.0.2.1"); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	next := totpCode(key, totpStep(time.Now())+1)
+	if _, _, err := s.VerifyMFA(ctx, mfaToken, next, "192.0.2.1"); !errors.Is(err, errInvalidMFAToken) {
+		t.Fatalf("reused challenge: err = %v, want errInvalidMFAToken", err)
+	}
+}
+
+func TestVerifyMFACapsChallengeAttempts(t *testing.T) {
+	tests := []struct {
+		name    string
+		wrong   int
+		wantErr error
+	}{
+		{"below the cap", mfaChallengeMaxAttempts - 1, nil},
+		{"at the cap", mfaChallengeMaxAttempts, errInvalidMFAToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without login throttling, which would step in first
+			s := newTestAuthService(t, NewLoginThrottle(NewMemoryLoginAttemptStore(), 0, 0, time.Minute))
+			user := createTestUser(t, s, "alice@example.com")
+			key := enableTestMFA(t, s, user.ID)
+			mfaToken := startMFALogin(t, s, user.Email)
+
+			for i := 0; i < tt.wrong; i++ {
+				if _, _, err := s.VerifyMFA(ctx, mfaToken, "wrong-code", "192.0.2.1"); !errors.Is(err, errInvalidMFACode) {
+					t.Fatalf("attempt %d: err = %v, want errInvalidMFACode", i+1, err)
+				}
+			}
+
+			// The right code no longer helps once the attempts are used up
+			_, _, err := s.VerifyMFA(ctx, mfaToken, totpCode(key, totpStep(time.Now())), "192.0.2.1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("correct code: err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyMFAThrottlesWrongCodes(t *testing.T) {
+	s := newTestAuthService(t, nil)
+	user := createTestUser(t, s, "alice@example.com")
+	enableTestMFA(t, s, user.ID)
+
+	// Each round has the right password, which must not clear the failures
+	// of the wrong codes before it
+	for i := 0; i < 3; i++ {
+		if _, _, err := s.VerifyMFA(ctx, startMFALogin(t, s, user.Email), "wrong-code", "192.0.2.1"); !errors.Is(err, errInvalidMFACode) {
+			t.Fatalf("round %d: err = %v, want errInvalidMFACode", i+1, err)
+		}
+	}
+
+	_, err := s.Login(ctx, user.Email, testPassword, "192.0.2.1")
+	if !errors.Is(err, services.ErrRateLimited) {
+		t.Fatalf("login after wrong codes: err = %v, want ErrRateLimited", err)
+	}
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hello/mail"
+	"hello/models"
+	"hello/repositories"
+	"hello/services"
+	"log"
+	"time"
+)
+
+const (
+	passwordResetTTL = 30 * time.Minute
+	mailTimeout      = 30 * time.Second
+)
+
+var errInvalidResetToken = services.NewError(services.ErrValidation, "invalid or expired reset token")
+
+// ForgotPassword emails the user a link to set a new password. It succeeds
+// whether or not the email belongs to an account and sends in the
+// background, so neither the response nor its timing tells which addresses
+// are registered.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = s.resetRepo.Create(ctx, &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "重置密码",
+		Body: fmt.Sprintf("%s，您好：\n\n请在 %d 分钟内打开以下链接设置新密码：\n\n%s/reset-password?token=%s\n\n如果这不是您本人的操作，请忽略此邮件，您的密码不会改变。\n",
+			user.Name, int(passwordResetTTL.Minutes()), s.baseURL, token),
+	}
+	go s.sendMail(context.WithoutCancel(ctx), msg, user.ID)
+	return nil
+}
+
+func (s *AuthService) sendMail(ctx context.Context, msg mail.Message, userID uint) {
+	ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+	defer cancel()
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Printf("Failed to send %q email to user %d: %v", msg.Subject, userID, err)
+	}
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword. The
+// token and any other outstanding ones are used up, and every session of
+// the user is logged out.
+func (s *AuthService) ResetPassword(ctx context.Context, actor services.Actor, token, newPassword string) error {
+	stored, err := s.resetRepo.FindByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return errInvalidResetToken
+		}
+		return err
+	}
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return errInvalidResetToken
+	}
+
+	user, err := s.userRepo.FindByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return errInvalidResetToken
+		}
+		return err
+	}
+	// A rejected password leaves the token usable for another try
+	if err := s.passwords.Check(ctx, user, "new_password", newPassword); err != nil {
+		return err
+	}
+
+	ok, err := s.resetRepo.MarkUsed(ctx, stored.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidResetToken
+	}
+
+	if err := s.savePassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+	if err := s.resetRepo.InvalidateForUser(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := s.LogoutAll(ctx, user.ID); err != nil {
+		return err
+	}
+
+	// The reset is attributed to the account itself
+	actor.UserID = user.ID
+	s.audit.Record(ctx, actor, models.AuditActionPasswordReset, user.ID, user, user)
+	return nil
+}
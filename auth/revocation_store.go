@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"hello/models"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevocationStore keeps track of access tokens that must be rejected before
+// their natural expiry.
+type RevocationStore interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	RevokeAllForUser(ctx context.Context, userID uint, before time.Time) error
+	RevokedBefore(ctx context.Context, userID uint) (time.Time, error)
+}
+
+// IsTokenRevoked reports whether the claims belong to a token that was
+// revoked individually or by a "log out all sessions" cutoff.
+func IsTokenRevoked(ctx context.Context, store RevocationStore, claims *Claims) (bool, error) {
+	if claims.ID != "" {
+		revoked, err := store.IsRevoked(ctx, claims.ID)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	cutoff, err := store.RevokedBefore(ctx, claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	if cutoff.IsZero() {
+		return false, nil
+	}
+	issuedAt := claims.issuedAt()
+	return issuedAt.IsZero() || !issuedAt.After(cutoff), nil
+}
+
+type memoryRevocationStore struct {
+	mu      sync.RWMutex
+	tokens  map[string]time.Time
+	cutoffs map[uint]time.Time
+}
+
+func NewMemoryRevocationStore() RevocationStore {
+	return &memoryRevocationStore{
+		tokens:  make(map[string]time.Time),
+		cutoffs: make(map[uint]time.Time),
+	}
+}
+
+func (s *memoryRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range s.tokens {
+		if now.After(exp) {
+			delete(s.tokens, id)
+		}
+	}
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *memoryRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.tokens[jti]
+	return ok, nil
+}
+
+func (s *memoryRevocationStore) RevokeAllForUser(ctx context.Context, userID uint, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cutoffs[userID] = before
+	return nil
+}
+
+func (s *memoryRevocationStore) RevokedBefore(ctx context.Context, userID uint) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cutoffs[userID], nil
+}
+
+type dbRevocationStore struct {
+	db *gorm.DB
+}
+
+func NewDBRevocationStore(db *gorm.DB) RevocationStore {
+	return &dbRevocationStore{db: db}
+}
+
+func (s *dbRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := s.db.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+
+	token := &models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error
+}
+
+func (s *dbRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+func (s *dbRevocationStore) RevokeAllForUser(ctx context.Context, userID uint, before time.Time) error {
+	cutoff := &models.UserSessionCutoff{UserID: userID, RevokedBefore: before}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"revoked_before", "updated_at"}),
+	}).Create(cutoff).Error
+}
+
+func (s *dbRevocationStore) RevokedBefore(ctx context.Context, userID uint) (time.Time, error) {
+	var cutoff models.UserSessionCutoff
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&cutoff).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cutoff.RevokedBefore, nil
+}
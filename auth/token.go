@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hello/models"
+)
+
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+}
+
+// LoginResult is the outcome of the password step of a login. Tokens is set
+// when the login is complete; otherwise MFAToken must be verified first.
+type LoginResult struct {
+	User         *models.User
+	Tokens       *TokenPair
+	MFAToken     string
+	MFAExpiresIn int64
+}
+
+// generateOpaqueToken returns a random URL-safe token suitable for handing
+// to clients; only its hash is ever persisted.
+func generateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, the ASCII
+// string "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit codes; a 6-digit code is their last six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0)
+		if got := totpCode(key, totpStep(now)); got != tt.code {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+		step, ok := matchTOTP(rfc6238Secret, tt.code, now)
+		if !ok || step != totpStep(now) {
+			t.Errorf("matchTOTP at %d = %d, %v, want %d, true", tt.unix, step, ok, totpStep(now))
+		}
+	}
+}
+
+func TestMatchTOTPAllowsOneStepOfDrift(t *testing.T) {
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	now := time.Unix(1111111111, 0)
+	code := totpCode(key, totpStep(now))
+
+	tests := []struct {
+		name string
+		at   time.Time
+		ok   bool
+	}{
+		{"same step", now, true},
+		{"one step later", now.Add(totpPeriod * time.Second), true},
+		{"one step earlier", now.Add(-totpPeriod * time.Second), true},
+		{"two steps later", now.Add(2 * totpPeriod * time.Second), false},
+		{"two steps earlier", now.Add(-2 * totpPeriod * time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := matchTOTP(rfc6238Secret, code, tt.at); ok != tt.ok {
+				t.Fatalf("matchTOTP = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMatchTOTPRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		name, secret, code string
+	}{
+		{"short code", rfc6238Secret, "28708"},
+		{"long code", rfc6238Secret, "2870820"},
+		{"wrong code", rfc6238Secret, "287083"},
+		{"invalid secret", "not base32!", "287082"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := matchTOTP(tt.secret, tt.code, now); ok {
+				t.Fatal("matchTOTP accepted the code")
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"hello/config"
 	"hello/database"
+	"hello/migrations"
 	"hello/models"
 	"hello/repositories"
+	"hello/services"
 	"log"
 	"time"
 
@@ -43,19 +46,38 @@ func main() {
 	}
 	fmt.Println("✓ 数据库连接成功")
 
+	// Make sure the schema exists before seeding
+	if _, err := migrations.NewMigrator(database.GetDB()).Up(0); err != nil {
+		log.Fatalf("数据库迁移失败: %v", err)
+	}
+	fmt.Println("✓ 数据库迁移完成")
+
+	ctx := context.Background()
 	db := database.GetDB()
 	userRepo := repositories.NewUserRepository(db)
+	roleService := services.NewRoleService(repositories.NewRoleRepository(db), userRepo, services.NewAuditService(repositories.NewAuditLogRepository(db)))
+
+	// Seed roles and permissions
+	if err := roleService.EnsureDefaultRoles(ctx); err != nil {
+		log.Fatalf("初始化角色失败: %v", err)
+	}
+	fmt.Println("✓ 角色与权限初始化完成")
 
 	// Delete all existing users
 	fmt.Println()
 	fmt.Println("正在清理现有用户数据...")
+	if err := db.Exec("DELETE FROM user_roles").Error; err != nil {
+		log.Fatalf("删除用户角色失败: %v", err)
+	}
 	if err := db.Exec("DELETE FROM users").Error; err != nil {
 		log.Fatalf("删除用户数据失败: %v", err)
 	}
 	fmt.Println("✓ 已清理所有现有用户数据")
 
 	// Reset auto increment
-	db.Exec("ALTER TABLE users AUTO_INCREMENT = 1")
+	if err := database.GetDialect().ResetAutoIncrement(db, "users"); err != nil {
+		log.Printf("重置自增 ID 失败: %v", err)
+	}
 
 	// Hash passwords
 	adminPassword := hashPassword("admin123")
@@ -92,13 +114,24 @@ func main() {
 			Status:    data.Status,
 			CreatedAt: now,
 			UpdatedAt: now,
+			// Test accounts use example.com addresses that cannot receive mail
+			EmailVerifiedAt:   &now,
+			PasswordChangedAt: &now,
 		}
 
-		if err := userRepo.Create(user); err != nil {
+		if err := userRepo.Create(ctx, user); err != nil {
 			log.Printf("插入用户 %s 失败: %v", data.Name, err)
-		} else {
-			fmt.Printf("  [%d] ✓ %s (%s)\n", i+1, data.Name, data.Email)
+			continue
+		}
+
+		role := models.RoleUser
+		if data.Email == "admin@example.com" {
+			role = models.RoleAdmin
+		}
+		if err := roleService.AssignRole(ctx, services.Actor{}, user.ID, role); err != nil {
+			log.Printf("为用户 %s 分配角色失败: %v", data.Name, err)
 		}
+		fmt.Printf("  [%d] ✓ %s (%s) [%s]\n", i+1, data.Name, data.Email, role)
 	}
 
 	fmt.Println()
@@ -108,7 +141,7 @@ func main() {
 	fmt.Println()
 	fmt.Println("测试账号信息:")
 	fmt.Println()
-	fmt.Println("管理员账号:")
+	fmt.Println("管理员账号 (admin 角色):")
 	fmt.Println("  邮箱: admin@example.com")
 	fmt.Println("  密码: admin123")
 	fmt.Println()
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"hello/config"
+	"hello/database"
+	"hello/migrations"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `用法: go run cmd/migrate/main.go <命令> [参数]
+
+命令:
+  up [n]         应用 n 个待执行的迁移 (默认全部)
+  down [n]       回滚最近的 n 个迁移 (默认 1)
+  status         查看迁移状态
+  create <name>  在 migrations 目录下生成新的迁移文件
+`
+
+var migrationTemplate = template.Must(template.New("migration").Parse(`package migrations
+
+import "gorm.io/gorm"
+
+func init() {
+	register(Migration{
+		Version: "{{.Version}}",
+		Name:    "{{.Name}}",
+		Up: func(tx *gorm.DB) error {
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	})
+}
+`))
+
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+
+	command, args := os.Args[1], os.Args[2:]
+
+	// create only writes a file and does not need a database
+	if command == "create" {
+		if len(args) != 1 {
+			fmt.Print(usage)
+			os.Exit(2)
+		}
+		if err := create(args[0]); err != nil {
+			log.Fatalf("创建迁移失败: %v", err)
+		}
+		return
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found, using default values")
+	}
+
+	cfg := config.LoadConfig()
+	if err := database.Connect(cfg); err != nil {
+		log.Fatalf("数据库连接失败: %v", err)
+	}
+	migrator := migrations.NewMigrator(database.GetDB())
+
+	switch command {
+	case "up":
+		done, err := migrator.Up(parseSteps(args, 0))
+		for _, m := range done {
+			fmt.Printf("✓ 已应用 %s_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("迁移失败: %v", err)
+		}
+		if len(done) == 0 {
+			fmt.Println("没有待执行的迁移")
+		}
+	case "down":
+		done, err := migrator.Down(parseSteps(args, 1))
+		for _, m := range done {
+			fmt.Printf("✓ 已回滚 %s_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("回滚失败: %v", err)
+		}
+		if len(done) == 0 {
+			fmt.Println("没有可回滚的迁移")
+		}
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatalf("读取迁移状态失败: %v", err)
+		}
+		for _, s := range statuses {
+			state := "待执行"
+			if s.Applied {
+				state = "已应用 " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%s_%-40s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+}
+
+func parseSteps(args []string, fallback int) int {
+	if len(args) == 0 {
+		return fallback
+	}
+	steps, err := strconv.Atoi(args[0])
+	if err != nil || steps < 0 {
+		log.Fatalf("无效的步数: %s", args[0])
+	}
+	return steps
+}
+
+func create(name string) error {
+	name = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "-", "_"))
+	if !migrationName.MatchString(name) {
+		return fmt.Errorf("invalid migration name %q: use lowercase letters, digits and underscores", name)
+	}
+
+	version := time.Now().UTC().Format("20060102150405")
+	path := filepath.Join("migrations", version+"_"+name+".go")
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := migrationTemplate.Execute(file, map[string]string{"Version": version, "Name": name}); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ 已创建 %s\n", path)
+	return nil
+}
@@ -2,29 +2,85 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
-	DBHost         string
-	DBPort         string
-	DBUser         string
-	DBPassword     string
-	DBName         string
-	ServerPort     string
-	JWTSecret      string
-	JWTExpiration  int
+	DBDriver             string
+	DBHost               string
+	DBPort               string
+	DBUser               string
+	DBPassword           string
+	DBName               string
+	DBSSLMode            string
+	DBPath               string
+	DBTimeout            int
+	ServerPort           string
+	TrustedProxies       []string
+	JWTSecret            string
+	JWTExpiration        int
+	JWTRefreshExpiration int
+	TokenRevocationStore string
+	LoginAttemptStore    string
+	LoginMaxFailures     int
+	LoginMaxIPFailures   int
+	LoginLockout         int
+	PasswordMinLength    int
+	PasswordClasses      string
+	PasswordHistory      int
+	PasswordMaxAgeDays   int
+	UserRetentionDays    int
+	UserPurgeInterval    int
+	MFAIssuer            string
+	EmailVerification    string
+	AppBaseURL           string
+	Mailer               string
+	MailFrom             string
+	MailFile             string
+	SMTPHost             string
+	SMTPPort             string
+	SMTPUsername         string
+	SMTPPassword         string
 }
 
 func LoadConfig() *Config {
 	return &Config{
-		DBHost:        getEnv("DB_HOST", "localhost"),
-		DBPort:        getEnv("DB_PORT", "3306"),
-		DBUser:        getEnv("DB_USER", "root"),
-		DBPassword:    getEnv("DB_PASSWORD", ""),
-		DBName:        getEnv("DB_NAME", "user_management"),
-		ServerPort:    getEnv("SERVER_PORT", "8080"),
-		JWTSecret:     getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-		JWTExpiration: 24 * 60 * 60, // 24 hours in seconds
+		DBDriver:             getEnv("DB_DRIVER", "mysql"), // mysql, postgres or sqlite
+		DBHost:               getEnv("DB_HOST", "localhost"),
+		DBPort:               getEnv("DB_PORT", ""), // defaults to the driver's standard port
+		DBUser:               getEnv("DB_USER", "root"),
+		DBPassword:           getEnv("DB_PASSWORD", ""),
+		DBName:               getEnv("DB_NAME", "user_management"),
+		DBSSLMode:            getEnv("DB_SSLMODE", "disable"),         // postgres only
+		DBPath:               getEnv("DB_PATH", "user_management.db"), // sqlite only
+		DBTimeout:            getEnvInt("DB_TIMEOUT", 10),             // per request, in seconds; 0 disables
+		ServerPort:           getEnv("SERVER_PORT", "8080"),
+		TrustedProxies:       getEnvList("TRUSTED_PROXIES"), // IPs or CIDRs; none by default
+		JWTSecret:            getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		JWTExpiration:        getEnvInt("JWT_EXPIRATION", 15*60),              // 15 minutes in seconds
+		JWTRefreshExpiration: getEnvInt("JWT_REFRESH_EXPIRATION", 7*24*60*60), // 7 days in seconds
+		TokenRevocationStore: getEnv("TOKEN_REVOCATION_STORE", "database"),    // database or memory
+		LoginAttemptStore:    getEnv("LOGIN_ATTEMPT_STORE", "database"),       // database or memory
+		LoginMaxFailures:     getEnvInt("LOGIN_MAX_FAILURES", 5),              // per account; 0 disables
+		LoginMaxIPFailures:   getEnvInt("LOGIN_MAX_IP_FAILURES", 50),          // per client IP; 0 disables
+		LoginLockout:         getEnvInt("LOGIN_LOCKOUT", 15*60),               // 15 minutes in seconds
+		PasswordMinLength:    getEnvInt("PASSWORD_MIN_LENGTH", 8),             // in characters
+		PasswordClasses:      getEnv("PASSWORD_REQUIRED_CLASSES", ""),         // comma-separated: lower, upper, digit, symbol
+		PasswordHistory:      getEnvInt("PASSWORD_HISTORY", 3),                // 0 allows reuse
+		PasswordMaxAgeDays:   getEnvInt("PASSWORD_MAX_AGE_DAYS", 0),           // 0 disables expiry
+		UserRetentionDays:    getEnvInt("USER_RETENTION_DAYS", 30),            // 0 disables purging
+		UserPurgeInterval:    getEnvInt("USER_PURGE_INTERVAL", 60*60),         // 1 hour in seconds
+		MFAIssuer:            getEnv("MFA_ISSUER", "User Management"),         // shown in authenticator apps
+		AppBaseURL:           getEnv("APP_BASE_URL", "http://localhost:8080"), // used in links sent by email
+		EmailVerification:    getEnv("EMAIL_VERIFICATION", "optional"),        // optional, login or restricted
+		Mailer:               getEnv("MAILER", "log"),                         // smtp, file or log
+		MailFrom:             getEnv("MAIL_FROM", "User Management <noreply@example.com>"),
+		MailFile:             getEnv("MAIL_FILE", "mail.log"), // file mailer only
+		SMTPHost:             getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:             getEnv("SMTP_PORT", "587"),
+		SMTPUsername:         getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:         getEnv("SMTP_PASSWORD", ""),
 	}
 }
 
@@ -34,3 +90,23 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvList splits a comma-separated value, returning nil when it is unset.
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"hello/models"
+	"hello/problem"
+	"hello/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController struct {
+	service services.AuditService
+}
+
+func NewAuditController(service services.AuditService) *AuditController {
+	return &AuditController{service: service}
+}
+
+func (c *AuditController) SearchAuditLogs(ctx *gin.Context) {
+	var filter models.AuditLogFilter
+
+	if actor := ctx.Query("actor"); actor != "" {
+		id, err := strconv.ParseUint(actor, 10, 32)
+		if err != nil {
+			problem.Write(ctx, http.StatusBadRequest, "Invalid actor")
+			return
+		}
+		actorID := uint(id)
+		filter.ActorID = &actorID
+	}
+	if target := ctx.Query("target"); target != "" {
+		id, err := strconv.ParseUint(target, 10, 32)
+		if err != nil {
+			problem.Write(ctx, http.StatusBadRequest, "Invalid target")
+			return
+		}
+		targetID := uint(id)
+		filter.TargetID = &targetID
+	}
+	filter.Action = ctx.Query("action")
+
+	if from := ctx.Query("from"); from != "" {
+		t, err := parseTimeParam(from)
+		if err != nil {
+			problem.Write(ctx, http.StatusBadRequest, "Invalid from")
+			return
+		}
+		filter.From = &t
+	}
+	if to := ctx.Query("to"); to != "" {
+		t, err := parseTimeParam(to)
+		if err != nil {
+			problem.Write(ctx, http.StatusBadRequest, "Invalid to")
+			return
+		}
+		// A bare date covers the whole day
+		if len(to) == len("2006-01-02") {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		filter.To = &t
+	}
+
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid page")
+		return
+	}
+	size, err := strconv.Atoi(ctx.DefaultQuery("size", "20"))
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid size")
+		return
+	}
+
+	logs, total, err := c.service.Search(ctx.Request.Context(), filter, page, size)
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items": logs,
+		"page":  page,
+		"size":  size,
+		"total": total,
+	})
+}
+
+// parseTimeParam accepts RFC 3339 timestamps or plain dates in local time.
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
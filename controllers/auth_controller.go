@@ -3,7 +3,10 @@ package controllers
 import (
 	"hello/auth"
 	"hello/models"
+	"hello/problem"
+	"hello/services"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -23,39 +26,62 @@ func (c *AuthController) LoginPage(ctx *gin.Context) {
 	ctx.HTML(http.StatusOK, "login.html", nil)
 }
 
+func (c *AuthController) ResetPasswordPage(ctx *gin.Context) {
+	ctx.HTML(http.StatusOK, "reset_password.html", nil)
+}
+
+func (c *AuthController) VerifyEmailPage(ctx *gin.Context) {
+	ctx.HTML(http.StatusOK, "verify_email.html", nil)
+}
+
 func (c *AuthController) Login(ctx *gin.Context) {
 	var req models.LoginRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.BindError(ctx, err)
 		return
 	}
 
-	user, token, err := c.authService.Login(req.Email, req.Password)
+	result, err := c.authService.Login(ctx.Request.Context(), req.Email, req.Password, ctx.ClientIP())
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		problem.Error(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"token": token,
+	if result.Tokens == nil {
+		ctx.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+			"expires_in":   result.MFAExpiresIn,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, loginResponse(result.User, result.Tokens))
+}
+
+func loginResponse(user *models.User, tokens *auth.TokenPair) gin.H {
+	return gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 		"user": gin.H{
 			"id":    user.ID,
 			"name":  user.Name,
 			"email": user.Email,
 		},
-	})
+	}
 }
 
 func (c *AuthController) Register(ctx *gin.Context) {
 	var req models.CreateUserRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.BindError(ctx, err)
 		return
 	}
 
-	user, err := c.authService.Register(req.Name, req.Email, req.Password, req.Phone, req.Age, req.Status)
+	user, err := c.authService.Register(ctx.Request.Context(), currentActor(ctx), req.Name, req.Email, req.Password, req.Phone, req.Age)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.Error(ctx, err)
 		return
 	}
 
@@ -69,51 +95,268 @@ func (c *AuthController) Register(ctx *gin.Context) {
 	})
 }
 
+func (c *AuthController) Refresh(ctx *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		problem.BindError(ctx, err)
+		return
+	}
+
+	tokens, err := c.authService.Refresh(ctx.Request.Context(), req.RefreshToken)
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
 func (c *AuthController) Logout(ctx *gin.Context) {
+	var req models.LogoutRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			problem.BindError(ctx, err)
+			return
+		}
+	}
+
+	jti := ctx.GetString("jti")
+	expiresAt := ctx.GetTime("token_expires_at")
+	if err := c.authService.Logout(ctx.Request.Context(), jti, expiresAt, req.RefreshToken); err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
+func (c *AuthController) LogoutAll(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		problem.Write(ctx, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := c.authService.LogoutAll(ctx.Request.Context(), userID.(uint)); err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "All sessions logged out successfully"})
+}
+
 func (c *AuthController) GetCurrentUser(ctx *gin.Context) {
 	userID, exists := ctx.Get("user_id")
 	if !exists {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		problem.Write(ctx, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
-	user, err := c.authService.GetUserByID(userID.(uint))
+	user, err := c.authService.GetUserByID(ctx.Request.Context(), userID.(uint))
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		problem.Error(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"id":         user.ID,
-		"name":       user.Name,
-		"email":      user.Email,
-		"phone":      user.Phone,
-		"age":        user.Age,
-		"status":     user.Status,
-		"created_at": user.CreatedAt.Format(time.RFC3339),
+		"id":             user.ID,
+		"name":           user.Name,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified(),
+		"phone":          user.Phone,
+		"age":            user.Age,
+		"status":         user.Status,
+		"created_at":     user.CreatedAt.Format(time.RFC3339),
 	})
 }
 
 func (c *AuthController) ChangePassword(ctx *gin.Context) {
-	userID, exists := ctx.Get("user_id")
-	if !exists {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	if _, exists := ctx.Get("user_id"); !exists {
+		problem.Write(ctx, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
 	var req models.ChangePasswordRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.BindError(ctx, err)
 		return
 	}
 
-	if err := c.authService.ChangePassword(userID.(uint), req.OldPassword, req.NewPassword); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.authService.ChangePassword(ctx.Request.Context(), currentActor(ctx), req.OldPassword, req.NewPassword); err != nil {
+		problem.Error(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
+
+func (c *AuthController) ForgotPassword(ctx *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		problem.BindError(ctx, err)
+		return
+	}
+
+	if err := c.authService.ForgotPassword(ctx.Request.Context(), req.Email); err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "If the email is registered, a password reset link has been sent"})
+}
+
+func (c *AuthController) ResetPassword(ctx *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		problem.BindError(ctx, err)
+		return
+	}
+
+	if err := c.authService.ResetPassword(ctx.Request.Context(), currentActor(ctx), req.Token, req.NewPassword); err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+func (c *AuthController) GetPasswordPolicy(ctx *gin.Context) {
+	policy := c.authService.PasswordPolicy()
+	classes := policy.RequiredClasses
+	if classes == nil {
+		classes = []string{}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"min_length":       policy.MinLength,
+		"max_bytes":        services.MaxPasswordBytes,
+		"required_classes": classes,
+		"history":          policy.History,
+		"max_age_days":     int(policy.MaxAge.Hours() / 24),
+	})
+}
+
+func (c *AuthController) VerifyEmail(ctx *gin.Context) {
+	token := ctx.Query("token")
+	if token == "" {
+		problem.Write(ctx, http.StatusBadRequest, "Missing token")
+		return
+	}
+
+	if err := c.authService.VerifyEmail(ctx.Request.Context(), currentActor(ctx), token); err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+func (c *AuthController) ResendVerification(ctx *gin.Context) {
+	var req models.ResendVerificationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		problem.BindError(ctx, err)
+		return
+	}
+
+	if err := c.authService.ResendVerification(ctx.Request.Context(), req.Email); err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "If the email belongs to an unverified account, a verification link has been sent"})
+}
+
+func (c *AuthController) VerifyMFA(ctx *gin.Context) {
+	var req models.MFAVerifyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		problem.BindError(ctx, err)
+		return
+	}
+
+	user, tokens, err := c.authService.VerifyMFA(ctx.Request.Context(), req.MFAToken, req.Code, ctx.ClientIP())
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, loginResponse(user, tokens))
+}
+
+func (c *AuthController) GetMFAStatus(ctx *gin.Context) {
+	status, err := c.authService.GetMFAStatus(ctx.Request.Context(), currentActor(ctx).UserID)
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"enabled":                  status.Enabled,
+		"recovery_codes_remaining": status.RecoveryCodesRemaining,
+	})
+}
+
+func (c *AuthController) EnrollMFA(ctx *gin.Context) {
+	enrollment, err := c.authService.EnrollMFA(ctx.Request.Context(), currentActor(ctx))
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"secret":      enrollment.Secret,
+		"otpauth_uri": enrollment.URI,
+	})
+}
+
+func (c *AuthController) ConfirmMFA(ctx *gin.Context) {
+	var req models.MFAConfirmRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		problem.BindError(ctx, err)
+		return
+	}
+
+	codes, err := c.authService.ConfirmMFA(ctx.Request.Context(), currentActor(ctx), req.Code)
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func (c *AuthController) ResetMFA(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := c.authService.ResetMFA(ctx.Request.Context(), currentActor(ctx), uint(id)); err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
+
+func (c *AuthController) UnlockUser(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := c.authService.UnlockUser(ctx.Request.Context(), currentActor(ctx), uint(id)); err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
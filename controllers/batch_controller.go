@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"hello/models"
+	"hello/problem"
+	"hello/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BatchController struct {
+	service services.BatchService
+}
+
+func NewBatchController(service services.BatchService) *BatchController {
+	return &BatchController{service: service}
+}
+
+func (c *BatchController) ApplyBatch(ctx *gin.Context) {
+	var req models.BatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		problem.BindError(ctx, err)
+		return
+	}
+
+	result, err := c.service.Apply(ctx.Request.Context(), currentActor(ctx), &req)
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	for i := range result.Items {
+		if item := &result.Items[i]; item.Err != nil {
+			item.Code = problem.Status(item.Err)
+			item.Error = problem.Detail(item.Err)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"errors"
+	"hello/models"
+	"hello/problem"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errPreconditionRequired = errors.New("If-Match header is required")
+	errInvalidIfMatch       = errors.New("If-Match must be a single strong ETag or *")
+)
+
+func userETag(user *models.User) string {
+	return `"` + strconv.FormatUint(uint64(user.Version), 10) + `"`
+}
+
+func setUserETag(ctx *gin.Context, user *models.User) {
+	ctx.Header("ETag", userETag(user))
+}
+
+// ifMatchVersion extracts the version required by the If-Match header. It
+// returns 0 for "*", meaning any current version is acceptable.
+func ifMatchVersion(ctx *gin.Context) (uint, error) {
+	header := strings.TrimSpace(ctx.GetHeader("If-Match"))
+	if header == "" {
+		return 0, errPreconditionRequired
+	}
+	if header == "*" {
+		return 0, nil
+	}
+
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, errInvalidIfMatch
+	}
+	version, err := strconv.ParseUint(header[1:len(header)-1], 10, 32)
+	if err != nil || version == 0 {
+		return 0, errInvalidIfMatch
+	}
+	return uint(version), nil
+}
+
+// requireIfMatch writes the error response and returns false when the request
+// lacks a usable If-Match header.
+func requireIfMatch(ctx *gin.Context) (uint, bool) {
+	version, err := ifMatchVersion(ctx)
+	if errors.Is(err, errPreconditionRequired) {
+		problem.Write(ctx, http.StatusPreconditionRequired, err.Error())
+		return 0, false
+	}
+	if err != nil {
+		problem.Write(ctx, http.StatusPreconditionFailed, err.Error())
+		return 0, false
+	}
+	return version, true
+}
+
+// notModified reports whether If-None-Match already names the user's
+// current representation. Weak comparison is used, as RFC 9110 requires.
+func notModified(ctx *gin.Context, user *models.User) bool {
+	header := ctx.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	current := userETag(user)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
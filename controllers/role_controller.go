@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"hello/models"
+	"hello/problem"
+	"hello/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleController struct {
+	service services.RoleService
+}
+
+func NewRoleController(service services.RoleService) *RoleController {
+	return &RoleController{service: service}
+}
+
+func (c *RoleController) ListRoles(ctx *gin.Context) {
+	roles, err := c.service.ListRoles(ctx.Request.Context())
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, roles)
+}
+
+func (c *RoleController) GetUserRoles(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	roles, err := c.service.GetUserRoles(ctx.Request.Context(), uint(id))
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, roles)
+}
+
+func (c *RoleController) AssignRole(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req models.AssignRoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		problem.BindError(ctx, err)
+		return
+	}
+
+	if err := c.service.AssignRole(ctx.Request.Context(), currentActor(ctx), uint(id), req.Role); err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Role assigned successfully"})
+}
+
+func (c *RoleController) RemoveRole(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := c.service.RemoveRole(ctx.Request.Context(), currentActor(ctx), uint(id), ctx.Param("role")); err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Role removed successfully"})
+}
@@ -1,12 +1,21 @@
 package controllers
 
 import (
+	"errors"
 	"hello/models"
+	"hello/problem"
+	"hello/repositories"
 	"hello/services"
+	"hello/validation"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 type UserController struct {
@@ -18,23 +27,23 @@ func NewUserController(service services.UserService) *UserController {
 }
 
 func (c *UserController) IndexPage(ctx *gin.Context) {
-	users, err := c.service.GetAllUsers()
+	page, err := c.service.SearchUsers(ctx.Request.Context(), models.UserFilter{}, models.PageRequest{})
 	if err != nil {
-		ctx.HTML(http.StatusInternalServerError, "index.html", gin.H{
+		ctx.HTML(problem.Status(err), "index.html", gin.H{
 			"error": "Failed to load users",
 		})
 		return
 	}
 
 	ctx.HTML(http.StatusOK, "index.html", gin.H{
-		"users": users,
+		"users": page.Items,
 	})
 }
 
 func (c *UserController) CreatePage(ctx *gin.Context) {
 	ctx.HTML(http.StatusOK, "form.html", gin.H{
 		"title": "Create User",
-		"action": "/users",
+		"action": "/api/users",
 		"method": "POST",
 		"user":   nil,
 	})
@@ -47,7 +56,7 @@ func (c *UserController) EditPage(ctx *gin.Context) {
 		return
 	}
 
-	user, err := c.service.GetUserByID(uint(id))
+	user, err := c.service.GetUserByID(ctx.Request.Context(), uint(id))
 	if err != nil {
 		ctx.Redirect(http.StatusFound, "/")
 		return
@@ -55,7 +64,7 @@ func (c *UserController) EditPage(ctx *gin.Context) {
 
 	ctx.HTML(http.StatusOK, "form.html", gin.H{
 		"title": "Edit User",
-		"action": "/users/" + ctx.Param("id"),
+		"action": "/api/users/" + ctx.Param("id"),
 		"method": "PUT",
 		"user":   user,
 	})
@@ -68,9 +77,9 @@ func (c *UserController) DetailPage(ctx *gin.Context) {
 		return
 	}
 
-	user, err := c.service.GetUserByID(uint(id))
+	user, err := c.service.GetUserByID(ctx.Request.Context(), uint(id))
 	if err != nil {
-		ctx.HTML(http.StatusNotFound, "user_detail.html", gin.H{
+		ctx.HTML(problem.Status(err), "user_detail.html", gin.H{
 			"error": "User not found",
 		})
 		return
@@ -84,68 +93,182 @@ func (c *UserController) DetailPage(ctx *gin.Context) {
 func (c *UserController) CreateUser(ctx *gin.Context) {
 	var req models.CreateUserRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.BindError(ctx, err)
 		return
 	}
 
-	user, err := c.service.CreateUser(&req)
+	user, err := c.service.CreateUser(ctx.Request.Context(), currentActor(ctx), &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		problem.Error(ctx, err)
 		return
 	}
 
+	setUserETag(ctx, user)
 	ctx.JSON(http.StatusOK, user)
 }
 
-func (c *UserController) GetAllUsers(ctx *gin.Context) {
-	users, err := c.service.GetAllUsers()
+// ImportUsers creates users from a CSV or NDJSON file sent as the request
+// body. With dry_run=true the file is only checked.
+func (c *UserController) ImportUsers(ctx *gin.Context) {
+	dryRun, err := strconv.ParseBool(ctx.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid dry_run")
+		return
+	}
+
+	body := http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxImportBytes)
+	rows, err := parseImport(ctx.ContentType(), body, ctx.GetHeader("Accept-Language"))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		var tooLarge *http.MaxBytesError
+		status := http.StatusBadRequest
+		if errors.Is(err, errUnsupportedImportType) {
+			status = http.StatusUnsupportedMediaType
+		} else if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		problem.Write(ctx, status, err.Error())
 		return
 	}
 
-	ctx.JSON(http.StatusOK, users)
+	report, err := c.service.ImportUsers(ctx.Request.Context(), currentActor(ctx), rows, dryRun)
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+	for i := range report.Rows {
+		report.Rows[i].Errors = validation.Localize(report.Rows[i].Errors, ctx.GetHeader("Accept-Language"))
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// GetAllUsers lists users newest first. It takes the same paging and sorting
+// parameters as SearchUsers, without the filters.
+func (c *UserController) GetAllUsers(ctx *gin.Context) {
+	c.listUsers(ctx, models.UserFilter{})
 }
 
 func (c *UserController) SearchUsers(ctx *gin.Context) {
-	name := ctx.Query("name")
-	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	filter, ok := bindUserFilter(ctx)
+	if !ok {
+		return
+	}
+
+	c.listUsers(ctx, filter)
+}
+
+// ExportUsers streams the users matching the SearchUsers filters as a CSV,
+// NDJSON or XLSX download. Columns default to every exported column.
+func (c *UserController) ExportUsers(ctx *gin.Context) {
+	filter, ok := bindUserFilter(ctx)
+	if !ok {
+		return
+	}
+
+	columns, err := parseExportColumns(ctx.Query("columns"))
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		problem.Write(ctx, http.StatusBadRequest, err.Error())
 		return
 	}
-	size, err := strconv.Atoi(ctx.DefaultQuery("size", "10"))
+	format, ok := exportFormats[ctx.DefaultQuery("format", "csv")]
+	if !ok {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid format")
+		return
+	}
+
+	filename := "users-" + time.Now().Format("20060102-150405") + "." + format.extension
+	ctx.Header("Content-Type", format.contentType)
+	ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	encoder := format.newEncoder(ctx.Writer, columns)
+	defer encoder.Close()
+
+	err = c.service.ExportUsers(ctx.Request.Context(), filter, ctx.Query("sort_by"), ctx.Query("sort_order"), func(users []models.User) error {
+		if err := encoder.Encode(users); err != nil {
+			return err
+		}
+		ctx.Writer.Flush()
+		return nil
+	})
+	if err == nil {
+		err = encoder.Finish()
+	}
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size"})
+		// Once rows have gone out the status can no longer change, so the
+		// client only sees a truncated file
+		if ctx.Writer.Written() {
+			log.Printf("Export aborted after the response started: %v", err)
+			ctx.Abort()
+			return
+		}
+		ctx.Writer.Header().Del("Content-Disposition")
+		problem.Error(ctx, err)
+	}
+}
+
+// bindUserFilter reads the SearchUsers filters from the query string,
+// writing a problem response and returning false when they are invalid.
+func bindUserFilter(ctx *gin.Context) (models.UserFilter, bool) {
+	var filter models.UserFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		problem.BindError(ctx, err)
+		return filter, false
+	}
+	if from := ctx.Query("created_from"); from != "" {
+		t, err := parseTimeParam(from)
+		if err != nil {
+			problem.Write(ctx, http.StatusBadRequest, "Invalid created_from")
+			return filter, false
+		}
+		filter.CreatedFrom = &t
+	}
+	if to := ctx.Query("created_to"); to != "" {
+		t, err := parseTimeParam(to)
+		if err != nil {
+			problem.Write(ctx, http.StatusBadRequest, "Invalid created_to")
+			return filter, false
+		}
+		// A bare date covers the whole day
+		if len(to) == len("2006-01-02") {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		filter.CreatedTo = &t
+	}
+	return filter, true
+}
+
+func (c *UserController) listUsers(ctx *gin.Context, filter models.UserFilter) {
+	var req models.PageRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		problem.BindError(ctx, err)
 		return
 	}
-	sortBy := ctx.DefaultQuery("sort_by", "created_at")
-	sortOrder := ctx.DefaultQuery("sort_order", "desc")
 
-	users, total, err := c.service.SearchUsers(name, page, size, sortBy, sortOrder)
+	page, err := c.service.SearchUsers(ctx.Request.Context(), filter, req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		problem.Error(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"items": users,
-		"page":  page,
-		"size":  size,
-		"total": total,
-	})
+	ctx.JSON(http.StatusOK, page)
 }
 
 func (c *UserController) GetUserByID(ctx *gin.Context) {
 	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		problem.Write(ctx, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
-	user, err := c.service.GetUserByID(uint(id))
+	user, err := c.service.GetUserByID(ctx.Request.Context(), uint(id))
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		problem.Error(ctx, err)
+		return
+	}
+
+	setUserETag(ctx, user)
+	if notModified(ctx, user) {
+		ctx.Status(http.StatusNotModified)
 		return
 	}
 
@@ -155,37 +278,157 @@ func (c *UserController) GetUserByID(ctx *gin.Context) {
 func (c *UserController) UpdateUser(ctx *gin.Context) {
 	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		problem.Write(ctx, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	version, ok := requireIfMatch(ctx)
+	if !ok {
 		return
 	}
 
 	var req models.UpdateUserRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.BindError(ctx, err)
 		return
 	}
 
-	user, err := c.service.UpdateUser(uint(id), &req)
+	user, err := c.service.UpdateUser(ctx.Request.Context(), currentActor(ctx), uint(id), version, &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		problem.Error(ctx, err)
 		return
 	}
 
+	setUserETag(ctx, user)
 	ctx.JSON(http.StatusOK, user)
 }
 
+// PatchUser accepts either an RFC 7396 merge patch or an RFC 6902 JSON Patch,
+// selected by the request Content-Type.
+func (c *UserController) PatchUser(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	version, ok := requireIfMatch(ctx)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := c.service.GetUserByID(ctx.Request.Context(), uint(id))
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+	if version != 0 && user.Version != version {
+		problem.Error(ctx, repositories.ErrVersionConflict)
+		return
+	}
+
+	req, err := applyUserPatch(user, ctx.ContentType(), body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errUnsupportedPatchType) {
+			status = http.StatusUnsupportedMediaType
+		} else if errors.Is(err, jsonpatch.ErrTestFailed) {
+			status = http.StatusConflict
+		}
+		problem.Write(ctx, status, err.Error())
+		return
+	}
+
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		problem.BindError(ctx, err)
+		return
+	}
+
+	updated, err := c.service.PatchUser(ctx.Request.Context(), currentActor(ctx), uint(id), user.Version, req)
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	setUserETag(ctx, updated)
+	ctx.JSON(http.StatusOK, updated)
+}
+
 func (c *UserController) DeleteUser(ctx *gin.Context) {
 	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		problem.Write(ctx, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
-	err = c.service.DeleteUser(uint(id))
+	version, ok := requireIfMatch(ctx)
+	if !ok {
+		return
+	}
+
+	err = c.service.DeleteUser(ctx.Request.Context(), currentActor(ctx), uint(id), version)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		problem.Error(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
+
+func (c *UserController) ListDeletedUsers(ctx *gin.Context) {
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid page")
+		return
+	}
+	size, err := strconv.Atoi(ctx.DefaultQuery("size", "10"))
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid size")
+		return
+	}
+
+	users, total, err := c.service.ListDeletedUsers(ctx.Request.Context(), page, size)
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items": users,
+		"page":  page,
+		"size":  size,
+		"total": total,
+	})
+}
+
+func (c *UserController) RestoreUser(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		problem.Write(ctx, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := c.service.RestoreUser(ctx.Request.Context(), currentActor(ctx), uint(id))
+	if err != nil {
+		problem.Error(ctx, err)
+		return
+	}
+
+	setUserETag(ctx, user)
+	ctx.JSON(http.StatusOK, user)
+}
+
+func currentActor(ctx *gin.Context) services.Actor {
+	return services.Actor{
+		UserID:    ctx.GetUint("user_id"),
+		Roles:     ctx.GetStringSlice("roles"),
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	}
+}
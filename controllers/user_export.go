@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hello/models"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// exportColumn is a user attribute that can be exported. The password hash
+// is deliberately not one of them.
+type exportColumn struct {
+	name  string
+	value func(user *models.User) interface{}
+}
+
+var exportColumns = []exportColumn{
+	{"id", func(u *models.User) interface{} { return u.ID }},
+	{"name", func(u *models.User) interface{} { return u.Name }},
+	{"email", func(u *models.User) interface{} { return u.Email }},
+	{"phone", func(u *models.User) interface{} { return u.Phone }},
+	{"age", func(u *models.User) interface{} { return u.Age }},
+	{"status", func(u *models.User) interface{} { return u.Status }},
+	{"roles", func(u *models.User) interface{} { return u.RoleNames() }},
+	{"created_at", func(u *models.User) interface{} { return u.CreatedAt }},
+	{"updated_at", func(u *models.User) interface{} { return u.UpdatedAt }},
+}
+
+// parseExportColumns resolves a comma-separated list of column names, in the
+// order given. An empty list selects every column.
+func parseExportColumns(list string) ([]exportColumn, error) {
+	if strings.TrimSpace(list) == "" {
+		return exportColumns, nil
+	}
+
+	var columns []exportColumn
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, column := range exportColumns {
+			if column.name == name {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+	return columns, nil
+}
+
+// userEncoder writes an export file. Encode is called once per batch of
+// users and Finish once all were encoded, also when there were none. Close
+// releases the encoder's resources whether or not the export completed.
+type userEncoder interface {
+	Encode(users []models.User) error
+	Finish() error
+	Close() error
+}
+
+type exportFormat struct {
+	contentType string
+	extension   string
+	newEncoder  func(w io.Writer, columns []exportColumn) userEncoder
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv": {
+		contentType: "text/csv; charset=utf-8",
+		extension:   "csv",
+		newEncoder:  newCSVEncoder,
+	},
+	"ndjson": {
+		contentType: ndjsonContentType,
+		extension:   "ndjson",
+		newEncoder:  newNDJSONEncoder,
+	},
+	"xlsx": {
+		contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		extension:   "xlsx",
+		newEncoder:  newXLSXEncoder,
+	},
+}
+
+// exportTimeLayout formats timestamps in the spreadsheet formats.
+const exportTimeLayout = "2006-01-02 15:04:05"
+
+// cellText renders a column value as spreadsheet text.
+func cellText(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Local().Format(exportTimeLayout)
+	case []string:
+		return strings.Join(v, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// csvFormulaPrefixes start cells that spreadsheet programs evaluate as
+// formulas when opening a CSV file.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvCellText is cellText for CSV files. Text that would be evaluated as a
+// formula, such as a name of "=HYPERLINK(...)", is prefixed with a quote so
+// it is shown as entered. XLSX cells are typed as text and need no escaping.
+func csvCellText(value interface{}) string {
+	text := cellText(value)
+	if text != "" && strings.ContainsRune(csvFormulaPrefixes, rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+type csvEncoder struct {
+	out     io.Writer
+	w       *csv.Writer
+	columns []exportColumn
+	started bool
+}
+
+func newCSVEncoder(w io.Writer, columns []exportColumn) userEncoder {
+	return &csvEncoder{out: w, w: csv.NewWriter(w), columns: columns}
+}
+
+// start writes the header, preceded by a byte order mark so spreadsheet
+// programs read the file as UTF-8.
+func (e *csvEncoder) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+
+	if _, err := io.WriteString(e.out, "\ufeff"); err != nil {
+		return err
+	}
+	header := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		header[i] = column.name
+	}
+	return e.w.Write(header)
+}
+
+func (e *csvEncoder) Encode(users []models.User) error {
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	record := make([]string, len(e.columns))
+	for i := range users {
+		for j, column := range e.columns {
+			record[j] = csvCellText(column.value(&users[i]))
+		}
+		if err := e.w.Write(record); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) Finish() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) Close() error {
+	return nil
+}
+
+type ndjsonEncoder struct {
+	enc     *json.Encoder
+	columns []exportColumn
+}
+
+func newNDJSONEncoder(w io.Writer, columns []exportColumn) userEncoder {
+	return &ndjsonEncoder{enc: json.NewEncoder(w), columns: columns}
+}
+
+func (e *ndjsonEncoder) Encode(users []models.User) error {
+	for i := range users {
+		record := make(map[string]interface{}, len(e.columns))
+		for _, column := range e.columns {
+			record[column.name] = column.value(&users[i])
+		}
+		if err := e.enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ndjsonEncoder) Finish() error {
+	return nil
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+// xlsxEncoder builds the workbook with excelize's stream writer, which
+// spills to a temporary file once the sheet grows large. The workbook can
+// only be sent once complete, so nothing is written to w before Finish.
+type xlsxEncoder struct {
+	out     io.Writer
+	file    *excelize.File
+	sheet   *excelize.StreamWriter
+	columns []exportColumn
+	row     int
+	err     error
+}
+
+func newXLSXEncoder(w io.Writer, columns []exportColumn) userEncoder {
+	e := &xlsxEncoder{out: w, file: excelize.NewFile(), columns: columns, row: 1}
+
+	e.sheet, e.err = e.file.NewStreamWriter("Sheet1")
+	if e.err == nil {
+		header := make([]interface{}, len(columns))
+		for i, column := range columns {
+			header[i] = column.name
+		}
+		e.err = e.writeRow(header)
+	}
+	return e
+}
+
+func (e *xlsxEncoder) writeRow(values []interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(1, e.row)
+	if err != nil {
+		return err
+	}
+	e.row++
+	return e.sheet.SetRow(cell, values)
+}
+
+func (e *xlsxEncoder) Encode(users []models.User) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	values := make([]interface{}, len(e.columns))
+	for i := range users {
+		for j, column := range e.columns {
+			// Numbers stay numeric so they can be summed and sorted
+			switch value := column.value(&users[i]).(type) {
+			case time.Time, []string:
+				values[j] = cellText(value)
+			default:
+				values[j] = value
+			}
+		}
+		if err := e.writeRow(values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *xlsxEncoder) Finish() error {
+	if e.err != nil {
+		return e.err
+	}
+	if err := e.sheet.Flush(); err != nil {
+		return err
+	}
+	_, err := e.file.WriteTo(e.out)
+	return err
+}
+
+// Close removes the temporary files of the stream writer.
+func (e *xlsxEncoder) Close() error {
+	return e.file.Close()
+}
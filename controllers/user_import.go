@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hello/models"
+	"hello/validation"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	csvContentType    = "text/csv"
+	ndjsonContentType = "application/x-ndjson"
+
+	// maxImportBytes bounds the request body of an import
+	maxImportBytes = 10 << 20
+)
+
+var errUnsupportedImportType = errors.New("unsupported import content type, use " + csvContentType + " or " + ndjsonContentType)
+
+// parseImport reads the rows of a CSV or NDJSON import file and validates each
+// against the CreateUserRequest rules. Problems with a single row are recorded
+// on the row; an error is only returned when the file as a whole is unusable.
+func parseImport(contentType string, body io.Reader, acceptLanguage string) ([]models.ImportRow, error) {
+	switch contentType {
+	case csvContentType:
+		return parseCSVImport(body, acceptLanguage)
+	case ndjsonContentType:
+		return parseNDJSONImport(body, acceptLanguage)
+	default:
+		return nil, errUnsupportedImportType
+	}
+}
+
+// parseCSVImport expects a header row naming the columns, in any order, out of
+// name, email, password, phone, age and status.
+func parseCSVImport(body io.Reader, acceptLanguage string) ([]models.ImportRow, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		// Spreadsheet programs often start the file with a byte order mark
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "name", "email", "password", "phone", "age", "status":
+		default:
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if _, dup := columns[name]; dup {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		columns[name] = i
+	}
+
+	var rows []models.ImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := models.ImportRow{Line: line}
+		if len(record) != len(header) {
+			row.Errors = append(row.Errors, validation.NewFieldError(acceptLanguage, "", "columns"))
+			rows = append(rows, row)
+			continue
+		}
+
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row.User = models.CreateUserRequest{
+			Name:     cell("name"),
+			Email:    cell("email"),
+			Password: cell("password"),
+			Phone:    cell("phone"),
+		}
+		if age := cell("age"); age != "" {
+			value, err := strconv.Atoi(age)
+			if err != nil {
+				row.Errors = append(row.Errors, validation.NewFieldError(acceptLanguage, "age", "format"))
+			}
+			row.User.Age = value
+		}
+		if status := cell("status"); status != "" {
+			value, err := strconv.Atoi(status)
+			if err != nil {
+				row.Errors = append(row.Errors, validation.NewFieldError(acceptLanguage, "status", "format"))
+			} else {
+				row.User.Status = &value
+			}
+		}
+
+		validateImportRow(&row, acceptLanguage)
+		rows = append(rows, row)
+	}
+}
+
+// parseNDJSONImport expects one CreateUserRequest JSON object per line. Blank
+// lines are skipped.
+func parseNDJSONImport(body io.Reader, acceptLanguage string) ([]models.ImportRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, 1<<20)
+
+	var rows []models.ImportRow
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		row := models.ImportRow{Line: line}
+		var typeErr *json.UnmarshalTypeError
+		if err := json.Unmarshal(text, &row.User); errors.As(err, &typeErr) {
+			row.Errors = append(row.Errors, validation.NewFieldError(acceptLanguage, typeErr.Field, "format"))
+		} else if err != nil {
+			row.Errors = append(row.Errors, validation.NewFieldError(acceptLanguage, "", "json"))
+			rows = append(rows, row)
+			continue
+		}
+
+		validateImportRow(&row, acceptLanguage)
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// validateImportRow adds the validation errors of the row, skipping fields
+// that already failed to parse.
+func validateImportRow(row *models.ImportRow, acceptLanguage string) {
+	err := binding.Validator.ValidateStruct(&row.User)
+	if err == nil {
+		return
+	}
+
+	unparsed := make(map[string]bool, len(row.Errors))
+	for _, fe := range row.Errors {
+		unparsed[fe.Field] = true
+	}
+	for _, fe := range validation.Translate(err, acceptLanguage) {
+		if !unparsed[fe.Field] {
+			row.Errors = append(row.Errors, fe)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hello/models"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+var errUnsupportedPatchType = errors.New("unsupported patch content type, use " + mergePatchContentType + " or " + jsonPatchContentType)
+
+// userDocument is the JSON representation that PATCH documents are applied
+// against. Only editable fields are exposed.
+type userDocument struct {
+	Name   *string `json:"name"`
+	Email  *string `json:"email"`
+	Phone  *string `json:"phone"`
+	Age    *int    `json:"age"`
+	Status *int    `json:"status"`
+}
+
+// applyUserPatch applies an RFC 7396 merge patch or an RFC 6902 JSON Patch to
+// the user and returns the fields whose values actually changed.
+func applyUserPatch(user *models.User, contentType string, body []byte) (*models.PatchUserRequest, error) {
+	original, err := json.Marshal(userDocument{
+		Name:   &user.Name,
+		Email:  &user.Email,
+		Phone:  &user.Phone,
+		Age:    &user.Age,
+		Status: &user.Status,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var patched []byte
+	switch contentType {
+	case jsonPatchContentType:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return nil, err
+		}
+		patched, err = patch.Apply(original)
+		if err != nil {
+			return nil, err
+		}
+	case mergePatchContentType, "application/json", "":
+		patched, err = jsonpatch.MergePatch(original, body)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errUnsupportedPatchType
+	}
+
+	var doc userDocument
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid patch result: %w", err)
+	}
+
+	// Removing an optional field clears it; required fields cannot be removed
+	empty, zero := "", 0
+	if doc.Phone == nil {
+		doc.Phone = &empty
+	}
+	if doc.Age == nil {
+		doc.Age = &zero
+	}
+	switch {
+	case doc.Name == nil:
+		return nil, errors.New("name cannot be removed")
+	case doc.Email == nil:
+		return nil, errors.New("email cannot be removed")
+	case doc.Status == nil:
+		return nil, errors.New("status cannot be removed")
+	}
+
+	req := &models.PatchUserRequest{}
+	if *doc.Name != user.Name {
+		req.Name = doc.Name
+	}
+	if *doc.Email != user.Email {
+		req.Email = doc.Email
+	}
+	if *doc.Phone != user.Phone {
+		req.Phone = doc.Phone
+	}
+	if *doc.Age != user.Age {
+		req.Age = doc.Age
+	}
+	if *doc.Status != user.Status {
+		req.Status = doc.Status
+	}
+	return req, nil
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// contextErrors makes a query that failed because its context was cancelled
+// or timed out report context.Canceled or context.DeadlineExceeded. Some
+// drivers return their own error instead, such as SQLite's "interrupted".
+type contextErrors struct{}
+
+func (contextErrors) Name() string {
+	return "context_errors"
+}
+
+func (contextErrors) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	processors := []interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}{
+		callbacks.Create().After("*"),
+		callbacks.Query().After("*"),
+		callbacks.Update().After("*"),
+		callbacks.Delete().After("*"),
+		callbacks.Row().After("*"),
+		callbacks.Raw().After("*"),
+	}
+	for _, processor := range processors {
+		if err := processor.Register("context_errors:wrap", wrapContextError); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func wrapContextError(db *gorm.DB) {
+	if db.Error == nil || db.Statement.Context == nil {
+		return
+	}
+	ctxErr := db.Statement.Context.Err()
+	if ctxErr == nil || errors.Is(db.Error, ctxErr) {
+		return
+	}
+	db.Error = fmt.Errorf("%w: %v", ctxErr, db.Error)
+}
@@ -3,43 +3,37 @@ package database
 import (
 	"fmt"
 	"hello/config"
-	"hello/models"
 	"log"
 
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
-func Connect(cfg *config.Config) error {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		cfg.DBUser,
-		cfg.DBPassword,
-		cfg.DBHost,
-		cfg.DBPort,
-		cfg.DBName,
-	)
+var dialect Dialect
 
+func Connect(cfg *config.Config) error {
 	var err error
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+	dialect, err = DialectFor(cfg.DBDriver)
+	if err != nil {
+		return err
+	}
+
+	DB, err = gorm.Open(dialect.Open(cfg), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Info),
+		TranslateError: true,
 	})
 
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	log.Println("Database connected successfully")
-
-	// Auto migrate tables
-	err = DB.AutoMigrate(&models.User{})
-	if err != nil {
-		return fmt.Errorf("failed to migrate database: %w", err)
+	if err := DB.Use(contextErrors{}); err != nil {
+		return fmt.Errorf("failed to register database plugins: %w", err)
 	}
 
-	log.Println("Database migration completed")
+	log.Printf("Database connected successfully (%s)", dialect.Name())
 
 	return nil
 }
@@ -47,3 +41,7 @@ func Connect(cfg *config.Config) error {
 func GetDB() *gorm.DB {
 	return DB
 }
+
+func GetDialect() Dialect {
+	return dialect
+}
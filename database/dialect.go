@@ -0,0 +1,97 @@
+package database
+
+import (
+	"fmt"
+	"hello/config"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Dialect hides the differences between the supported database backends:
+// how to build a connection and any statements that are not portable SQL.
+type Dialect interface {
+	Name() string
+	Open(cfg *config.Config) gorm.Dialector
+	ResetAutoIncrement(db *gorm.DB, table string) error
+}
+
+func DialectFor(driver string) (Dialect, error) {
+	switch driver {
+	case "", "mysql":
+		return mysqlDialect{}, nil
+	case "postgres", "postgresql":
+		return postgresDialect{}, nil
+	case "sqlite", "sqlite3":
+		return sqliteDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+func portOrDefault(port, defaultPort string) string {
+	if port == "" {
+		return defaultPort
+	}
+	return port
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (mysqlDialect) Open(cfg *config.Config) gorm.Dialector {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		cfg.DBUser,
+		cfg.DBPassword,
+		cfg.DBHost,
+		portOrDefault(cfg.DBPort, "3306"),
+		cfg.DBName,
+	)
+	return mysql.Open(dsn)
+}
+
+func (mysqlDialect) ResetAutoIncrement(db *gorm.DB, table string) error {
+	return db.Exec(fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = 1", table)).Error
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (postgresDialect) Open(cfg *config.Config) gorm.Dialector {
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s TimeZone=Local",
+		cfg.DBHost,
+		portOrDefault(cfg.DBPort, "5432"),
+		cfg.DBUser,
+		cfg.DBPassword,
+		cfg.DBName,
+		cfg.DBSSLMode,
+	)
+	return postgres.Open(dsn)
+}
+
+func (postgresDialect) ResetAutoIncrement(db *gorm.DB, table string) error {
+	return db.Exec("SELECT setval(pg_get_serial_sequence(?, 'id'), 1, false)", table).Error
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) Open(cfg *config.Config) gorm.Dialector {
+	// Foreign keys are off by default in SQLite
+	return sqlite.Open(cfg.DBPath + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+}
+
+func (sqliteDialect) ResetAutoIncrement(db *gorm.DB, table string) error {
+	return db.Exec("DELETE FROM sqlite_sequence WHERE name = ?", table).Error
+}
@@ -1,32 +1,43 @@
--- 清理并初始化用户数据
+-- 清理并初始化用户数据 (MySQL 语法，其他数据库请使用 go run cmd/initdata/main.go)
 -- 注意: 此脚本会删除所有现有用户,请谨慎使用!
 
--- 1. 清空现有用户数据
-TRUNCATE TABLE users;
+-- 1. 清空现有用户数据 (先清理用户角色关联)
+DELETE FROM user_roles;
+DELETE FROM users;
 
 -- 2. 插入管理员用户
 -- 密码: admin123
-INSERT INTO users (name, email, password, phone, age, status, created_at, updated_at)
+INSERT INTO users (name, name_pinyin, name_initials, email, password, phone, age, status, created_at, updated_at, email_verified_at)
 VALUES (
     '系统管理员',
+    'xitongguanliyuan',
+    'xtgly',
     'admin@example.com',
     '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm',
     '13800138000',
     35,
     1,
     NOW(),
+    NOW(),
     NOW()
 );
 
 -- 3. 插入普通用户 (密码都是: password123)
-INSERT INTO users (name, email, password, phone, age, status, created_at, updated_at) VALUES
-('张三', 'zhangsan@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138001', 28, 1, NOW(), NOW()),
-('李四', 'lisi@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138002', 32, 1, NOW(), NOW()),
-('王五', 'wangwu@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138003', 25, 1, NOW(), NOW()),
-('赵六', 'zhaoliu@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138004', 30, 1, NOW(), NOW()),
-('钱七', 'qianqi@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138005', 27, 1, NOW(), NOW()),
-('孙八', 'sunba@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138006', 29, 1, NOW(), NOW()),
-('周九', 'zhoujiu@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138007', 31, 1, NOW(), NOW()),
-('吴十', 'wushi@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138008', 26, 1, NOW(), NOW()),
-('郑十一', 'zhengshiyi@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138009', 33, 1, NOW(), NOW()),
-('王十二', 'wangshier@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138010', 24, 1, NOW(), NOW());
+-- name_pinyin / name_initials 为姓名的全拼与首字母，用于拼音搜索，
+-- 与应用保存用户时由 utils.NamePinyin 计算的结果一致
+INSERT INTO users (name, name_pinyin, name_initials, email, password, phone, age, status, created_at, updated_at, email_verified_at) VALUES
+('张三', 'zhangsan', 'zs', 'zhangsan@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138001', 28, 1, NOW(), NOW(), NOW()),
+('李四', 'lisi', 'ls', 'lisi@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138002', 32, 1, NOW(), NOW(), NOW()),
+('王五', 'wangwu', 'ww', 'wangwu@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138003', 25, 1, NOW(), NOW(), NOW()),
+('赵六', 'zhaoliu', 'zl', 'zhaoliu@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138004', 30, 1, NOW(), NOW(), NOW()),
+('钱七', 'qianqi', 'qq', 'qianqi@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138005', 27, 1, NOW(), NOW(), NOW()),
+('孙八', 'sunba', 'sb', 'sunba@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138006', 29, 1, NOW(), NOW(), NOW()),
+('周九', 'zhoujiu', 'zj', 'zhoujiu@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138007', 31, 1, NOW(), NOW(), NOW()),
+('吴十', 'wushi', 'ws', 'wushi@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138008', 26, 1, NOW(), NOW(), NOW()),
+('郑十一', 'zhengshiyi', 'zsy', 'zhengshiyi@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138009', 33, 1, NOW(), NOW(), NOW()),
+('王十二', 'wangshier', 'wse', 'wangshier@example.com', '$2a$10$dFW4KzYxKkpq29a7lgnoUOcKYHsdIdXv4xIzLjlB/wwarQjZuZQhm', '13800138010', 24, 1, NOW(), NOW(), NOW());
+
+-- 4. 分配角色 (角色由服务启动时自动创建)
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u
+JOIN roles r ON r.name = IF(u.email = 'admin@example.com', 'admin', 'user');
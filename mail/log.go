@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+type logMailer struct{}
+
+// NewLogMailer writes messages to the standard logger instead of sending
+// them, for development.
+func NewLogMailer() Mailer {
+	return logMailer{}
+}
+
+func (logMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+type fileMailer struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+// NewFileMailer appends every message, formatted as it would be sent, to the
+// file at path. Messages are separated by a blank line.
+func NewFileMailer(path, from string) Mailer {
+	return &fileMailer{path: path, from: from}
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := format(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%s\r\n\r\n", data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,91 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string // empty disables authentication
+	Password string
+	From     string // an address, optionally with a display name
+}
+
+type smtpMailer struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPMailer sends through an SMTP server. Port 465 uses implicit TLS;
+// on other ports the connection is upgraded with STARTTLS when the server
+// offers it.
+func NewSMTPMailer(cfg SMTPConfig) Mailer {
+	return &smtpMailer{cfg: cfg}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	sender, err := netmail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return err
+	}
+	data, err := format(sender.String(), msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, m.cfg.Port)
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if m.cfg.Port == "465" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	// net/smtp has no context support; the deadline bounds the whole exchange
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && m.cfg.Port != "465" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(sender.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
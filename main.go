@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"hello/auth"
 	"hello/config"
 	"hello/controllers"
 	"hello/database"
+	"hello/mail"
+	"hello/middleware"
+	"hello/migrations"
 	"hello/repositories"
 	"hello/routes"
 	"hello/services"
+	"hello/validation"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,6 +24,10 @@ import (
 )
 
 func main() {
+	autoMigrate := flag.Bool("auto-migrate", false, "apply pending migrations before starting")
+	skipMigrationCheck := flag.Bool("skip-migration-check", false, "start even if migrations are pending")
+	flag.Parse()
+
 	// Load .env file
 	err := godotenv.Load()
 	if err != nil {
@@ -31,22 +43,131 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// Refuse to run against an outdated schema unless told otherwise
+	migrator := migrations.NewMigrator(database.GetDB())
+	if *autoMigrate {
+		done, err := migrator.Up(0)
+		if err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+		log.Printf("Applied %d migration(s)", len(done))
+	}
+	if err := migrator.EnsureCurrent(); err != nil {
+		if !errors.Is(err, migrations.ErrSchemaBehind) || !*skipMigrationCheck {
+			log.Fatalf("%v (run `go run cmd/migrate/main.go up`, start with -auto-migrate, or pass -skip-migration-check)", err)
+		}
+		log.Printf("Warning: %v", err)
+	}
+
+	// Initialize password policy
+	var passwordClasses []string
+	for _, class := range strings.Split(cfg.PasswordClasses, ",") {
+		if class = strings.TrimSpace(class); class != "" {
+			passwordClasses = append(passwordClasses, class)
+		}
+	}
+	passwordPolicy, err := services.NewPasswordPolicy(services.PasswordPolicyConfig{
+		MinLength:       cfg.PasswordMinLength,
+		RequiredClasses: passwordClasses,
+		History:         cfg.PasswordHistory,
+		MaxAge:          time.Duration(cfg.PasswordMaxAgeDays) * 24 * time.Hour,
+	}, repositories.NewPasswordHistoryRepository(database.GetDB()))
+	if err != nil {
+		log.Fatalf("Invalid password policy: %v", err)
+	}
+
 	// Initialize layers
 	userRepo := repositories.NewUserRepository(database.GetDB())
-	userService := services.NewUserService(userRepo)
+	roleRepo := repositories.NewRoleRepository(database.GetDB())
+	auditService := services.NewAuditService(repositories.NewAuditLogRepository(database.GetDB()))
+	auditController := controllers.NewAuditController(auditService)
+	userService := services.NewUserService(userRepo, roleRepo, auditService, passwordPolicy, time.Duration(cfg.DBTimeout)*time.Second)
 	userController := controllers.NewUserController(userService)
 
+	// Initialize roles and permissions
+	roleService := services.NewRoleService(roleRepo, userRepo, auditService)
+	if err := roleService.EnsureDefaultRoles(context.Background()); err != nil {
+		log.Fatalf("Failed to seed default roles: %v", err)
+	}
+	roleController := controllers.NewRoleController(roleService)
+	batchService := services.NewBatchService(userService, roleService, repositories.NewTransactor(database.GetDB()))
+	batchController := controllers.NewBatchController(batchService)
+
+	// Permanently remove soft-deleted users after the retention period
+	if cfg.UserRetentionDays > 0 {
+		retention := time.Duration(cfg.UserRetentionDays) * 24 * time.Hour
+		services.StartPurgeJob(userService, retention, time.Duration(cfg.UserPurgeInterval)*time.Second)
+	}
+
 	// Initialize JWT manager
 	jwtManager := auth.NewJWTManager(cfg.JWTSecret, time.Duration(cfg.JWTExpiration)*time.Second)
 
-	// Initialize auth service and controller
-	authService := auth.NewAuthService(userRepo, jwtManager)
+	// Initialize token revocation store
+	var revocations auth.RevocationStore
+	if cfg.TokenRevocationStore == "memory" {
+		revocations = auth.NewMemoryRevocationStore()
+	} else {
+		revocations = auth.NewDBRevocationStore(database.GetDB())
+	}
+
+	// Initialize login throttling
+	var loginAttempts auth.LoginAttemptStore
+	if cfg.LoginAttemptStore == "memory" {
+		loginAttempts = auth.NewMemoryLoginAttemptStore()
+	} else {
+		loginAttempts = auth.NewDBLoginAttemptStore(database.GetDB())
+	}
+	loginThrottle := auth.NewLoginThrottle(loginAttempts, cfg.LoginMaxFailures, cfg.LoginMaxIPFailures, time.Duration(cfg.LoginLockout)*time.Second)
+
+	// Initialize mailer
+	var mailer mail.Mailer
+	switch cfg.Mailer {
+	case "smtp":
+		mailer = mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+	case "file":
+		mailer = mail.NewFileMailer(cfg.MailFile, cfg.MailFrom)
+	default:
+		mailer = mail.NewLogMailer()
+	}
+
+	refreshTokenRepo := repositories.NewRefreshTokenRepository(database.GetDB())
+	mfaRepo := repositories.NewMFARepository(database.GetDB())
+	resetRepo := repositories.NewPasswordResetRepository(database.GetDB())
+	verifyRepo := repositories.NewEmailVerificationRepository(database.GetDB())
+	switch cfg.EmailVerification {
+	case auth.EmailVerificationOptional, auth.EmailVerificationLogin, auth.EmailVerificationRestricted:
+	default:
+		log.Fatalf("Unknown EMAIL_VERIFICATION mode %q", cfg.EmailVerification)
+	}
+	authService := auth.NewAuthService(userRepo, roleRepo, refreshTokenRepo, mfaRepo, resetRepo, verifyRepo, revocations, loginThrottle, passwordPolicy, auditService, mailer, jwtManager, time.Duration(cfg.JWTRefreshExpiration)*time.Second, cfg.MFAIssuer, cfg.AppBaseURL, cfg.EmailVerification)
 	authController := controllers.NewAuthController(authService)
 
 	// Setup Gin
+	if err := validation.Register(); err != nil {
+		log.Fatalf("Failed to register validators: %v", err)
+	}
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
 
+	// Only trust X-Forwarded-For from known proxies, so clients cannot choose
+	// the IP used for login throttling and audit logs
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Bound the time each request may spend in the database. Exports stream
+	// for as long as there are users to send, so the user service bounds each
+	// of their batch queries instead
+	if cfg.DBTimeout > 0 {
+		r.Use(middleware.RequestTimeout(time.Duration(cfg.DBTimeout)*time.Second, routes.ExportUsersPath))
+	}
+
 	// Load HTML templates
 	r.LoadHTMLGlob("templates/*")
 
@@ -54,7 +175,7 @@ func main() {
 	r.Static("/static", "./static")
 
 	// Setup routes
-	routes.SetupRoutes(r, userController, authController, jwtManager)
+	routes.SetupRoutes(r, userController, authController, roleController, auditController, batchController, jwtManager, revocations, roleService, cfg.EmailVerification == auth.EmailVerificationRestricted)
 
 	// Start server
 	addr := ":" + cfg.ServerPort
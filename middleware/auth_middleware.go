@@ -2,38 +2,52 @@ package middleware
 
 import (
 	"hello/auth"
+	"hello/problem"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
+func AuthMiddleware(jwtManager *auth.JWTManager, revocations auth.RevocationStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, "Authorization header is required")
 			return
 		}
 
 		parts := strings.SplitN(authHeader, " ", 2)
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, "Invalid authorization header format")
 			return
 		}
 
 		tokenString := parts[1]
 		claims, err := jwtManager.VerifyToken(tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+
+		revoked, err := auth.IsTokenRevoked(c.Request.Context(), revocations, claims)
+		if err != nil {
+			problem.AbortWithError(c, err)
+			return
+		}
+		if revoked {
+			problem.Abort(c, http.StatusUnauthorized, "Token has been revoked")
 			return
 		}
 
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
+		c.Set("roles", claims.Roles)
+		c.Set("email_verified", claims.EmailVerified)
+		c.Set("jti", claims.ID)
+		if claims.ExpiresAt != nil {
+			c.Set("token_expires_at", claims.ExpiresAt.Time)
+		}
 		c.Next()
 	}
 }
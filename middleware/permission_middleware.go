@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"hello/problem"
+	"hello/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission must run after AuthMiddleware; it checks the roles carried
+// in the token against the permission granted to each role.
+func RequirePermission(roleService services.RoleService, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roles := c.GetStringSlice("roles")
+
+		allowed, err := roleService.HasPermission(c.Request.Context(), roles, permission)
+		if err != nil {
+			problem.AbortWithError(c, err)
+			return
+		}
+		if !allowed {
+			problem.Abort(c, http.StatusForbidden, "Permission denied: "+permission)
+			return
+		}
+
+		c.Next()
+	}
+}
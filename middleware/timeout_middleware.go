@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestTimeout bounds the request context, and with it every database call
+// made on behalf of the request. Work still running when the deadline passes
+// fails with context.DeadlineExceeded.
+//
+// Routes listed in exempt, such as streaming downloads that run for as long
+// as there is data to send, are not bounded; their handlers must apply the
+// timeout to each database call themselves.
+func RequestTimeout(timeout time.Duration, exempt ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		skip[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if skip[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"hello/problem"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVerifiedEmail must run after AuthMiddleware; it rejects tokens
+// issued to users whose email was not verified at the time.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("email_verified") {
+			problem.Abort(c, http.StatusForbidden, "Email address is not verified")
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,124 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// initialSchemaModels is a snapshot of the models at the time of this
+// migration; it must not follow later model changes. The types are local
+// so their names, which GORM uses for table and constraint names, match the
+// models without clashing with snapshots in other migrations.
+func initialSchemaModels() []interface{} {
+	type permission struct {
+		ID          uint   `gorm:"primaryKey"`
+		Name        string `gorm:"type:varchar(100);uniqueIndex;not null"`
+		Description string `gorm:"type:varchar(255)"`
+		CreatedAt   time.Time
+	}
+
+	type role struct {
+		ID          uint         `gorm:"primaryKey"`
+		Name        string       `gorm:"type:varchar(50);uniqueIndex;not null"`
+		Description string       `gorm:"type:varchar(255)"`
+		Permissions []permission `gorm:"many2many:role_permissions"`
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+	}
+
+	type user struct {
+		ID         uint   `gorm:"primaryKey"`
+		Name       string `gorm:"type:varchar(100);not null"`
+		Email      string `gorm:"type:varchar(100);uniqueIndex:idx_users_email_active,priority:1;not null"`
+		Password   string `gorm:"type:varchar(255);not null"`
+		Phone      string `gorm:"type:varchar(20)"`
+		Age        int    `gorm:"type:int"`
+		Status     int    `gorm:"type:int;not null"`
+		Roles      []role `gorm:"many2many:user_roles"`
+		Version    uint   `gorm:"not null;default:1"`
+		CreatedAt  time.Time
+		UpdatedAt  time.Time
+		DeletedAt  gorm.DeletedAt `gorm:"index"`
+		DeletedKey uint           `gorm:"not null;default:0;uniqueIndex:idx_users_email_active,priority:2"`
+	}
+
+	type refreshToken struct {
+		ID        uint      `gorm:"primaryKey"`
+		UserID    uint      `gorm:"index;not null"`
+		FamilyID  string    `gorm:"type:varchar(64);index;not null"`
+		TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+		ExpiresAt time.Time `gorm:"not null"`
+		UsedAt    *time.Time
+		RevokedAt *time.Time
+		CreatedAt time.Time
+	}
+
+	type revokedToken struct {
+		ID        uint      `gorm:"primaryKey"`
+		JTI       string    `gorm:"column:jti;type:varchar(64);uniqueIndex;not null"`
+		ExpiresAt time.Time `gorm:"index;not null"`
+		CreatedAt time.Time
+	}
+
+	type userSessionCutoff struct {
+		UserID        uint      `gorm:"primaryKey;autoIncrement:false"`
+		RevokedBefore time.Time `gorm:"not null"`
+		UpdatedAt     time.Time
+	}
+
+	type auditLog struct {
+		ID        uint      `gorm:"primaryKey"`
+		ActorID   uint      `gorm:"index"`
+		Action    string    `gorm:"type:varchar(50);index;not null"`
+		TargetID  uint      `gorm:"index"`
+		Changes   string    `gorm:"type:text"`
+		IP        string    `gorm:"type:varchar(45)"`
+		UserAgent string    `gorm:"type:varchar(255)"`
+		CreatedAt time.Time `gorm:"index"`
+	}
+
+	return []interface{}{
+		&user{},
+		&role{},
+		&permission{},
+		&refreshToken{},
+		&revokedToken{},
+		&userSessionCutoff{},
+		&auditLog{},
+	}
+}
+
+func init() {
+	register(Migration{
+		Version: "20260118000000",
+		Name:    "initial_schema",
+		// AutoMigrate keeps the baseline safe to apply to databases that were
+		// created by the server's old startup AutoMigrate
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(initialSchemaModels()...); err != nil {
+				return err
+			}
+
+			// Email uniqueness lives in idx_users_email_active so soft-deleted
+			// rows do not block reuse of their address
+			if tx.Migrator().HasIndex("users", "idx_users_email") {
+				return tx.Migrator().DropIndex("users", "idx_users_email")
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(
+				"user_roles",
+				"role_permissions",
+				"audit_logs",
+				"user_session_cutoffs",
+				"revoked_tokens",
+				"refresh_tokens",
+				"permissions",
+				"roles",
+				"users",
+			)
+		},
+	})
+}
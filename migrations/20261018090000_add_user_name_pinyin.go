@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"hello/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// userNamePinyin is the users table as this migration sees it.
+type userNamePinyin struct {
+	ID           uint   `gorm:"primaryKey"`
+	Name         string `gorm:"type:varchar(100);not null"`
+	NamePinyin   string `gorm:"type:varchar(255);index:idx_users_name_pinyin"`
+	NameInitials string `gorm:"type:varchar(100);index:idx_users_name_initials"`
+}
+
+func (userNamePinyin) TableName() string {
+	return "users"
+}
+
+func init() {
+	register(Migration{
+		Version: "20261018090000",
+		Name:    "add_user_name_pinyin",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, field := range []string{"NamePinyin", "NameInitials"} {
+				if err := m.AddColumn(&userNamePinyin{}, field); err != nil {
+					return err
+				}
+			}
+			for _, index := range []string{"idx_users_name_pinyin", "idx_users_name_initials"} {
+				if err := m.CreateIndex(&userNamePinyin{}, index); err != nil {
+					return err
+				}
+			}
+
+			// Backfill existing rows, soft-deleted ones included
+			var batch []userNamePinyin
+			return tx.Select("id", "name").FindInBatches(&batch, 500, func(b *gorm.DB, _ int) error {
+				for _, u := range batch {
+					full, initials := utils.NamePinyin(u.Name)
+					err := tx.Model(&userNamePinyin{}).Where("id = ?", u.ID).UpdateColumns(map[string]interface{}{
+						"name_pinyin":   full,
+						"name_initials": initials,
+					}).Error
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, index := range []string{"idx_users_name_pinyin", "idx_users_name_initials"} {
+				if err := m.DropIndex(&userNamePinyin{}, index); err != nil {
+					return err
+				}
+			}
+			// Migrator.DropColumn rebuilds the table on SQLite, which the
+			// foreign keys referencing users do not allow
+			for _, column := range []string{"name_pinyin", "name_initials"} {
+				if err := tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "users"}, clause.Column{Name: column}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
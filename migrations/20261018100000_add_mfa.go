@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// mfaModels is a snapshot of the MFA models at the time of this migration.
+func mfaModels() []interface{} {
+	type mfaSecret struct {
+		UserID       uint   `gorm:"primaryKey;autoIncrement:false"`
+		Secret       string `gorm:"type:varchar(64);not null"`
+		ConfirmedAt  *time.Time
+		LastUsedStep int64 `gorm:"not null;default:0"`
+		CreatedAt    time.Time
+		UpdatedAt    time.Time
+	}
+
+	type mfaRecoveryCode struct {
+		ID        uint   `gorm:"primaryKey"`
+		UserID    uint   `gorm:"index;not null"`
+		CodeHash  string `gorm:"type:varchar(64);not null"`
+		UsedAt    *time.Time
+		CreatedAt time.Time
+	}
+
+	type mfaChallenge struct {
+		ID        uint      `gorm:"primaryKey"`
+		UserID    uint      `gorm:"index;not null"`
+		TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+		Attempts  int       `gorm:"not null;default:0"`
+		ExpiresAt time.Time `gorm:"index;not null"`
+		UsedAt    *time.Time
+		CreatedAt time.Time
+	}
+
+	return []interface{}{
+		&mfaSecret{},
+		&mfaRecoveryCode{},
+		&mfaChallenge{},
+	}
+}
+
+func init() {
+	register(Migration{
+		Version: "20261018100000",
+		Name:    "add_mfa",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(mfaModels()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("mfa_challenges", "mfa_recovery_codes", "mfa_secrets")
+		},
+	})
+}
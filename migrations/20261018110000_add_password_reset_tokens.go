@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// passwordResetToken is a snapshot of the model at the time of this
+// migration.
+type passwordResetToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index;not null"`
+	TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func init() {
+	register(Migration{
+		Version: "20261018110000",
+		Name:    "add_password_reset_tokens",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&passwordResetToken{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("password_reset_tokens")
+		},
+	})
+}
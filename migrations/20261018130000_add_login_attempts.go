@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// loginAttempt is a snapshot of the model at the time of this migration.
+type loginAttempt struct {
+	Key           string    `gorm:"column:attempt_key;type:varchar(191);primaryKey"`
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"index;not null"`
+	LockedUntil   *time.Time
+}
+
+func init() {
+	register(Migration{
+		Version: "20261018130000",
+		Name:    "add_login_attempts",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&loginAttempt{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("login_attempts")
+		},
+	})
+}
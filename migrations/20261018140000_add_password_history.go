@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// userPasswordChanged is the users table as this migration sees it.
+type userPasswordChanged struct {
+	ID                uint `gorm:"primaryKey"`
+	PasswordChangedAt *time.Time
+}
+
+func (userPasswordChanged) TableName() string {
+	return "users"
+}
+
+// previousPassword is a snapshot of the model at the time of this migration.
+type previousPassword struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"index;not null"`
+	PasswordHash string `gorm:"type:varchar(255);not null"`
+	CreatedAt    time.Time
+}
+
+func init() {
+	register(Migration{
+		Version: "20261018140000",
+		Name:    "add_password_history",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&userPasswordChanged{}, "PasswordChangedAt"); err != nil {
+				return err
+			}
+			// When existing passwords were set is unknown; counting from now
+			// keeps a maximum password age from expiring them all at once
+			if err := tx.Exec("UPDATE ? SET password_changed_at = ?", clause.Table{Name: "users"}, time.Now()).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(&previousPassword{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable("previous_passwords"); err != nil {
+				return err
+			}
+			// Migrator.DropColumn rebuilds the table on SQLite, which the
+			// foreign keys referencing users do not allow
+			return tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "users"}, clause.Column{Name: "password_changed_at"}).Error
+		},
+	})
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditActionUserCreate     = "user.create"
+	AuditActionUserRegister   = "user.register"
+	AuditActionUserUpdate     = "user.update"
+	AuditActionUserDelete     = "user.delete"
+	AuditActionUserRestore    = "user.restore"
+	AuditActionUserPurge      = "user.purge"
+	AuditActionUserUnlock     = "user.unlock"
+	AuditActionPasswordChange = "user.password_change"
+	AuditActionPasswordReset  = "user.password_reset"
+	AuditActionEmailVerify    = "user.email_verify"
+	AuditActionRoleAssign     = "user.role_assign"
+	AuditActionRoleRemove     = "user.role_remove"
+	AuditActionMFAEnable      = "user.mfa_enable"
+	AuditActionMFAReset       = "user.mfa_reset"
+)
+
+// AuditLog is append-only: rows are inserted and queried but never updated
+// or deleted.
+type AuditLog struct {
+	ID        uint            `json:"id" gorm:"primaryKey"`
+	ActorID   uint            `json:"actor_id" gorm:"index"` // 0 for anonymous or system actions
+	Action    string          `json:"action" gorm:"type:varchar(50);index;not null"`
+	TargetID  uint            `json:"target_id" gorm:"index"`
+	Changes   json.RawMessage `json:"changes" gorm:"type:text"`
+	IP        string          `json:"ip" gorm:"type:varchar(45)"`
+	UserAgent string          `json:"user_agent" gorm:"type:varchar(255)"`
+	CreatedAt time.Time       `json:"created_at" gorm:"index"`
+}
+
+type AuditLogFilter struct {
+	ActorID  *uint
+	TargetID *uint
+	Action   string
+	From     *time.Time
+	To       *time.Time
+}
+
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// EmailVerificationToken confirms that the user controls Email. It no longer
+// verifies anything once the user's email has changed.
+type EmailVerificationToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	Email     string     `json:"email" gorm:"type:varchar(100);not null"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"index;not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
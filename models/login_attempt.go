@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginAttempt counts recent failed logins for an account or a client IP.
+// Key is "account:<email>" or "ip:<address>".
+type LoginAttempt struct {
+	Key           string     `json:"key" gorm:"column:attempt_key;type:varchar(191);primaryKey"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time  `json:"last_failure_at" gorm:"index;not null"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
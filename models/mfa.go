@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// MFASecret is a user's TOTP enrollment. Until ConfirmedAt is set the
+// enrollment is pending and login does not ask for a code. The secret has to
+// be readable to verify codes, so unlike passwords and tokens it is stored as
+// is.
+type MFASecret struct {
+	UserID       uint       `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Secret       string     `json:"-" gorm:"type:varchar(64);not null"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	LastUsedStep int64      `json:"-" gorm:"not null;default:0"` // rejects replayed codes
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func (m *MFASecret) Enabled() bool {
+	return m.ConfirmedAt != nil
+}
+
+// MFARecoveryCode is a single-use code that stands in for a TOTP code when
+// the user has lost their authenticator.
+type MFARecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	CodeHash  string     `json:"-" gorm:"type:varchar(64);not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// MFAChallenge is handed out by the password step of a login and exchanged
+// for tokens once the second factor is verified.
+type MFAChallenge struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	Attempts  int        `json:"attempts" gorm:"not null;default:0"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"index;not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type MFAConfirmRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAVerifyRequest completes a login. Code is a TOTP code or a recovery code.
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
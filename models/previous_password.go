@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// PreviousPassword keeps the hash of a password a user replaced, so that it
+// cannot be chosen again while it is among the most recent ones.
+type PreviousPassword struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"index;not null"`
+	PasswordHash string    `json:"-" gorm:"type:varchar(255);not null"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+const (
+	PermissionUsersRead   = "users:read"
+	PermissionUsersCreate = "users:create"
+	PermissionUsersUpdate = "users:update"
+	PermissionUsersDelete = "users:delete"
+	PermissionRolesManage = "roles:manage"
+	PermissionAuditRead   = "audit:read"
+)
+
+type Role struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	Name        string       `json:"name" gorm:"type:varchar(50);uniqueIndex;not null"`
+	Description string       `json:"description" gorm:"type:varchar(255)"`
+	Permissions []Permission `json:"permissions,omitempty" gorm:"many2many:role_permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+type Permission struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"type:varchar(100);uniqueIndex;not null"`
+	Description string    `json:"description" gorm:"type:varchar(255)"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
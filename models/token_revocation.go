@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+type RevokedToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	JTI       string    `json:"jti" gorm:"column:jti;type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserSessionCutoff invalidates every access token of a user issued at or
+// before RevokedBefore.
+type UserSessionCutoff struct {
+	UserID        uint      `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	RevokedBefore time.Time `json:"revoked_before" gorm:"not null"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
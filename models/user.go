@@ -1,36 +1,140 @@
 package models
 
 import (
+	"hello/utils"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Name      string    `json:"name" gorm:"type:varchar(100);not null"`
-	Email     string    `json:"email" gorm:"type:varchar(100);uniqueIndex;not null"`
-	Password  string    `json:"-" gorm:"type:varchar(255);not null"`
-	Phone     string    `json:"phone" gorm:"type:varchar(20)"`
-	Age       int       `json:"age" gorm:"type:int"`
-	Status    int       `json:"status" gorm:"type:int;default:1"` // 1: active, 0: inactive
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Name      string         `json:"name" gorm:"type:varchar(100);not null"`
+	Email     string         `json:"email" gorm:"type:varchar(100);uniqueIndex:idx_users_email_active,priority:1;not null"`
+	Password  string         `json:"-" gorm:"type:varchar(255);not null"`
+	Phone     string         `json:"phone" gorm:"type:varchar(20)"`
+	Age       int            `json:"age" gorm:"type:int"`
+	Status    int            `json:"status" gorm:"type:int;not null"` // 1: active, 0: inactive
+	Roles     []Role         `json:"roles,omitempty" gorm:"many2many:user_roles"`
+	Version   uint           `json:"version" gorm:"not null;default:1"` // incremented on every update
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	// DeletedKey is 0 for live rows and the row ID once soft-deleted, so the
+	// unique index on (email, deleted_key) only constrains live users.
+	DeletedKey uint `json:"-" gorm:"not null;default:0;uniqueIndex:idx_users_email_active,priority:2"`
+	// NamePinyin and NameInitials are derived from Name on every save so
+	// names can be searched by typing pinyin, e.g. "zhangsan" or "zs".
+	NamePinyin   string `json:"-" gorm:"type:varchar(255);index"`
+	NameInitials string `json:"-" gorm:"type:varchar(100);index"`
+	// EmailVerifiedAt is set once the user follows the link mailed to Email
+	// and cleared when Email changes.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// PasswordChangedAt is when Password was last set, for the maximum
+	// password age.
+	PasswordChangedAt *time.Time `json:"password_changed_at"`
+}
+
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	u.NamePinyin, u.NameInitials = utils.NamePinyin(u.Name)
+	return nil
+}
+
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.Version == 0 {
+		u.Version = 1
+	}
+	return nil
+}
+
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+func (u *User) RoleNames() []string {
+	names := make([]string, 0, len(u.Roles))
+	for _, role := range u.Roles {
+		names = append(names, role.Name)
+	}
+	return names
 }
 
 type CreateUserRequest struct {
 	Name     string `json:"name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
-	Phone    string `json:"phone"`
-	Age      int    `json:"age"`
-	Status   int    `json:"status"`
+	Password string `json:"password" binding:"required"`
+	Phone    string `json:"phone" binding:"phone"`
+	Age      int    `json:"age" binding:"age"`
+	Status   *int   `json:"status" binding:"omitnil,oneof=0 1"`
 }
 
+// StatusOrDefault returns the requested status, defaulting to active.
+func (r *CreateUserRequest) StatusOrDefault() int {
+	if r.Status == nil {
+		return 1
+	}
+	return *r.Status
+}
+
+// UpdateUserRequest is a full replacement of the editable fields (PUT).
+// Omitted optional fields are cleared.
 type UpdateUserRequest struct {
-	Name   string `json:"name"`
-	Email  string `json:"email" binding:"omitempty,email"`
-	Phone  string `json:"phone"`
-	Age    int    `json:"age"`
-	Status int    `json:"status"`
+	Name   string `json:"name" binding:"required"`
+	Email  string `json:"email" binding:"required,email"`
+	Phone  string `json:"phone" binding:"phone"`
+	Age    int    `json:"age" binding:"age"`
+	Status *int   `json:"status" binding:"required,oneof=0 1"`
+}
+
+// PatchUserRequest is a partial update (PATCH). Nil fields are left
+// unchanged; non-nil fields are written even when they hold zero values.
+type PatchUserRequest struct {
+	Name   *string `json:"name" binding:"omitnil,min=1"`
+	Email  *string `json:"email" binding:"omitnil,email"`
+	Phone  *string `json:"phone" binding:"omitnil,phone"`
+	Age    *int    `json:"age" binding:"omitnil,age"`
+	Status *int    `json:"status" binding:"omitnil,oneof=0 1"`
+}
+
+// UserFilter narrows GET /api/users/search. Every filter that is set must
+// match. Name matches a substring of the name. Q matches a substring of the
+// name, email, phone or name pinyin, or the start of the name initials, and
+// ranks results when sorting by relevance. EmailDomain matches the part of
+// the email after "@" and PhonePrefix the start of the phone number.
+// CreatedFrom and CreatedTo are inclusive.
+type UserFilter struct {
+	Name        string     `form:"name"`
+	Q           string     `form:"q"`
+	Status      *int       `form:"status" binding:"omitnil,oneof=0 1"`
+	MinAge      *int       `form:"min_age" binding:"omitnil,age"`
+	MaxAge      *int       `form:"max_age" binding:"omitnil,age"`
+	CreatedFrom *time.Time `form:"-"`
+	CreatedTo   *time.Time `form:"-"`
+	EmailDomain string     `form:"email_domain"`
+	PhonePrefix string     `form:"phone_prefix"`
+}
+
+// PageRequest selects a page of a listing by page number or, when After or
+// Before holds a cursor from a previous response, by position.
+type PageRequest struct {
+	Page      int    `form:"page,default=1"`
+	Size      int    `form:"size,default=10"`
+	SortBy    string `form:"sort_by,default=created_at"`
+	SortOrder string `form:"sort_order,default=desc"`
+	After     string `form:"after"`
+	Before    string `form:"before"`
+}
+
+// UserPage is one page of a user listing. Page and Total are only reported
+// for page-number requests, since cursor requests skip the count. NextCursor
+// and PrevCursor are empty when there is nothing further in that direction.
+type UserPage struct {
+	Items      []User `json:"items"`
+	Page       int    `json:"page,omitempty"`
+	Size       int    `json:"size"`
+	Total      *int64 `json:"total,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
 }
 
 type LoginRequest struct {
@@ -40,5 +144,5 @@ type LoginRequest struct {
 
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
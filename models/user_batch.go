@@ -0,0 +1,54 @@
+package models
+
+// Operations accepted by POST /api/users/batch.
+const (
+	BatchOpSetStatus  = "set_status"
+	BatchOpDelete     = "delete"
+	BatchOpRestore    = "restore"
+	BatchOpAssignRole = "assign_role"
+)
+
+// Item statuses in a BatchResult. In an all-or-nothing batch, items that
+// succeeded before another item failed are rolled back, and items after the
+// failure are skipped.
+const (
+	BatchItemSucceeded  = "succeeded"
+	BatchItemFailed     = "failed"
+	BatchItemRolledBack = "rolled_back"
+	BatchItemSkipped    = "skipped"
+)
+
+// BatchOperation applies Op to every user in IDs. Status is required by
+// set_status and Role by assign_role.
+type BatchOperation struct {
+	Op     string `json:"op" binding:"required,oneof=set_status delete restore assign_role"`
+	IDs    []uint `json:"ids" binding:"required,min=1"`
+	Status *int   `json:"status" binding:"omitnil,oneof=0 1"`
+	Role   string `json:"role"`
+}
+
+// BatchRequest is the body of POST /api/users/batch. Operations run in
+// order. By default the batch is all-or-nothing; with BestEffort every item
+// that can be applied is applied.
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations" binding:"required,min=1,dive"`
+	BestEffort bool             `json:"best_effort"`
+}
+
+// BatchItemResult is the outcome of one operation on one user. Err holds the
+// failure; controllers render it into Error and Code.
+type BatchItemResult struct {
+	Op     string `json:"op"`
+	ID     uint   `json:"id"`
+	Status string `json:"status"`
+	Code   int    `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Err    error  `json:"-"`
+}
+
+type BatchResult struct {
+	BestEffort bool              `json:"best_effort"`
+	Succeeded  int               `json:"succeeded"`
+	Failed     int               `json:"failed"`
+	Items      []BatchItemResult `json:"items"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "hello/validation"
+
+// Row statuses in an ImportReport.
+const (
+	ImportStatusCreated = "created"
+	ImportStatusValid   = "valid"
+	ImportStatusInvalid = "invalid"
+)
+
+// ImportRow is one record of a bulk import file. Line is where the record
+// starts in the file and Errors lists the problems found while parsing and
+// validating it.
+type ImportRow struct {
+	Line   int
+	User   CreateUserRequest
+	Errors []validation.FieldError
+}
+
+type ImportRowResult struct {
+	Line   int                     `json:"line"`
+	Email  string                  `json:"email,omitempty"`
+	Status string                  `json:"status"`
+	ID     uint                    `json:"id,omitempty"`
+	Errors []validation.FieldError `json:"errors,omitempty"`
+}
+
+// ImportReport describes the outcome of POST /api/users/import. Users are
+// only created when every row is valid and the import is not a dry run, in
+// which case Created equals Total; otherwise valid rows report
+// ImportStatusValid and nothing is written.
+type ImportReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Valid   int               `json:"valid"`
+	Invalid int               `json:"invalid"`
+	Created int               `json:"created"`
+	Rows    []ImportRowResult `json:"rows"`
+}
@@ -0,0 +1,163 @@
+// Package problem writes error responses as RFC 7807 problem details and maps
+// service and repository errors to HTTP status codes.
+package problem
+
+import (
+	"context"
+	"errors"
+	"hello/repositories"
+	"hello/services"
+	"hello/validation"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ContentType = "application/problem+json"
+
+// StatusClientClosedRequest is the non-standard status nginx uses for
+// requests the client abandoned before a response was written.
+const StatusClientClosedRequest = 499
+
+// Details is an RFC 7807 problem details object. Type is always about:blank,
+// so Title is the standard text of Status. Errors is an extension member
+// listing the fields that failed validation.
+type Details struct {
+	Type     string                  `json:"type"`
+	Title    string                  `json:"title"`
+	Status   int                     `json:"status"`
+	Detail   string                  `json:"detail,omitempty"`
+	Instance string                  `json:"instance,omitempty"`
+	Errors   []validation.FieldError `json:"errors,omitempty"`
+}
+
+func title(status int) string {
+	if status == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
+
+func newDetails(c *gin.Context, status int, detail string) Details {
+	return Details{
+		Type:     "about:blank",
+		Title:    title(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request.URL.Path,
+	}
+}
+
+func writeDetails(c *gin.Context, details Details) {
+	c.Header("Content-Type", ContentType)
+	c.JSON(details.Status, details)
+}
+
+// Write sends a problem response with the given status and detail.
+func Write(c *gin.Context, status int, detail string) {
+	writeDetails(c, newDetails(c, status, detail))
+}
+
+// Abort writes a problem response and stops the handler chain.
+func Abort(c *gin.Context, status int, detail string) {
+	Write(c, status, detail)
+	c.Abort()
+}
+
+// Status returns the HTTP status code for err.
+func Status(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, services.ErrNotFound), errors.Is(err, repositories.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repositories.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, services.ErrConflict), errors.Is(err, repositories.ErrDuplicate):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, services.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrRateLimited):
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// Detail returns the client-facing description of err. Unexpected errors are
+// not described, so internal details do not leak.
+func Detail(err error) string {
+	var domainErr *services.Error
+	switch {
+	case errors.As(err, &domainErr):
+		return domainErr.Message
+	case errors.Is(err, context.Canceled):
+		return "the request was cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "the request timed out"
+	case Status(err) == http.StatusInternalServerError:
+		return "internal server error"
+	}
+	return err.Error()
+}
+
+// Error writes the problem response for err, logging unexpected errors.
+// Errors that say when to retry set the Retry-After header, and errors about
+// request fields list them localized, as BindError does.
+func Error(c *gin.Context, err error) {
+	status := Status(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	}
+	var domainErr *services.Error
+	if errors.As(err, &domainErr) {
+		if domainErr.RetryAfter > 0 {
+			seconds := (domainErr.RetryAfter + time.Second - 1) / time.Second
+			c.Header("Retry-After", strconv.FormatInt(int64(seconds), 10))
+		}
+		if len(domainErr.Fields) > 0 {
+			writeFieldErrors(c, status, validation.Localize(domainErr.Fields, c.GetHeader("Accept-Language")))
+			return
+		}
+	}
+	Write(c, status, Detail(err))
+}
+
+// AbortWithError writes the problem response for err and stops the handler
+// chain.
+func AbortWithError(c *gin.Context, err error) {
+	Error(c, err)
+	c.Abort()
+}
+
+// BindError writes the response for a request body that could not be bound:
+// 422 with the localized field errors when it failed validation and 400 when
+// it could not be parsed.
+func BindError(c *gin.Context, err error) {
+	fieldErrs := validation.Translate(err, c.GetHeader("Accept-Language"))
+	if len(fieldErrs) == 0 {
+		Write(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeFieldErrors(c, http.StatusUnprocessableEntity, fieldErrs)
+}
+
+// writeFieldErrors sends the field errors with their messages as the detail.
+func writeFieldErrors(c *gin.Context, status int, fieldErrs []validation.FieldError) {
+	messages := make([]string, len(fieldErrs))
+	for i, fe := range fieldErrs {
+		messages[i] = fe.Message
+	}
+	details := newDetails(c, status, strings.Join(messages, "; "))
+	details.Errors = fieldErrs
+	writeDetails(c, details)
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"hello/models"
+
+	"gorm.io/gorm"
+)
+
+type AuditLogRepository interface {
+	Create(ctx context.Context, log *models.AuditLog) error
+	Search(ctx context.Context, filter models.AuditLogFilter, page, size int) ([]models.AuditLog, int64, error)
+}
+
+type auditLogRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditLogRepository(db *gorm.DB) AuditLogRepository {
+	return &auditLogRepository{db: db}
+}
+
+func (r *auditLogRepository) Create(ctx context.Context, log *models.AuditLog) error {
+	return dbFor(ctx, r.db).Create(log).Error
+}
+
+func (r *auditLogRepository) Search(ctx context.Context, filter models.AuditLogFilter, page, size int) ([]models.AuditLog, int64, error) {
+	var logs []models.AuditLog
+	var total int64
+
+	query := dbFor(ctx, r.db).Model(&models.AuditLog{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.TargetID != nil {
+		query = query.Where("target_id = ?", *filter.TargetID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * size
+	err := query.Order("id DESC").Limit(size).Offset(offset).Find(&logs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return logs, total, nil
+}
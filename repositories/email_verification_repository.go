@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+	"hello/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, token *models.EmailVerificationToken) error
+	FindByHash(ctx context.Context, hash string) (*models.EmailVerificationToken, error)
+	MarkUsed(ctx context.Context, id uint) (bool, error)
+	CountCreatedSince(ctx context.Context, userID uint, since time.Time) (int64, error)
+}
+
+type emailVerificationRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailVerificationRepository(db *gorm.DB) EmailVerificationRepository {
+	return &emailVerificationRepository{db: db}
+}
+
+// Create stores a new token and drops expired ones.
+func (r *emailVerificationRepository) Create(ctx context.Context, token *models.EmailVerificationToken) error {
+	if err := dbFor(ctx, r.db).Where("expires_at < ?", time.Now()).Delete(&models.EmailVerificationToken{}).Error; err != nil {
+		return err
+	}
+	return dbFor(ctx, r.db).Create(token).Error
+}
+
+func (r *emailVerificationRepository) FindByHash(ctx context.Context, hash string) (*models.EmailVerificationToken, error) {
+	var token models.EmailVerificationToken
+	err := dbFor(ctx, r.db).Where("token_hash = ?", hash).First(&token).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+// MarkUsed flags the token as consumed. It reports false when it had already
+// been used.
+func (r *emailVerificationRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	result := dbFor(ctx, r.db).Model(&models.EmailVerificationToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CountCreatedSince returns how many tokens were issued to the user after
+// since, used or not.
+func (r *emailVerificationRepository) CountCreatedSince(ctx context.Context, userID uint, since time.Time) (int64, error) {
+	var count int64
+	err := dbFor(ctx, r.db).Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND created_at > ?", userID, since).
+		Count(&count).Error
+	return count, err
+}
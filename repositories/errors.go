@@ -0,0 +1,32 @@
+package repositories
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound is returned when no record matches the lookup.
+	ErrNotFound = errors.New("record not found")
+
+	// ErrDuplicate is returned when a write would violate a unique
+	// constraint, such as two active users sharing an email.
+	ErrDuplicate = errors.New("duplicate record")
+
+	// ErrVersionConflict is returned when an update or delete targets a
+	// version of the user that is no longer current.
+	ErrVersionConflict = errors.New("user has been modified by another request")
+)
+
+// translateError replaces GORM's errors with the repository ones so callers
+// do not depend on the storage backend.
+func translateError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrDuplicate
+	}
+	return err
+}
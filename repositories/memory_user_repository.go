@@ -0,0 +1,506 @@
+package repositories
+
+import (
+	"cmp"
+	"context"
+	"hello/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// memoryUserRepository keeps users in a map and mirrors the behaviour of the
+// GORM implementation, including its errors, so services and controllers can
+// be exercised without a database. Roles are stored as given on the user.
+// Every method fails with the context's error once ctx is done.
+type memoryUserRepository struct {
+	mu     sync.RWMutex
+	users  map[uint]models.User
+	nextID uint
+}
+
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{users: make(map[uint]models.User), nextID: 1}
+}
+
+// cloneUser copies the user so callers never share memory with the store.
+func cloneUser(user models.User) models.User {
+	if user.Roles != nil {
+		user.Roles = append([]models.Role(nil), user.Roles...)
+	}
+	return user
+}
+
+// snapshot copies the stored users and returns a function that puts the copy
+// back, for rolling back a memoryTransactor.
+func (r *memoryUserRepository) snapshot() (restore func()) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make(map[uint]models.User, len(r.users))
+	for id, user := range r.users {
+		users[id] = cloneUser(user)
+	}
+	nextID := r.nextID
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.users, r.nextID = users, nextID
+	}
+}
+
+// emailTaken reports whether an active user other than id uses email, the
+// in-memory counterpart of idx_users_email_active.
+func (r *memoryUserRepository) emailTaken(email string, id uint) bool {
+	for _, user := range r.users {
+		if user.ID != id && !user.DeletedAt.Valid && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkCreate(user); err != nil {
+		return err
+	}
+	return r.insert(user)
+}
+
+// CreateBatch checks every user before inserting any, so a failed batch
+// leaves the store untouched like the rolled back GORM transaction.
+func (r *memoryUserRepository) CreateBatch(ctx context.Context, users []*models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	emails := make(map[string]bool, len(users))
+	for _, user := range users {
+		if err := r.checkCreate(user); err != nil {
+			return err
+		}
+		if !user.DeletedAt.Valid {
+			if emails[user.Email] {
+				return ErrDuplicate
+			}
+			emails[user.Email] = true
+		}
+	}
+
+	for _, user := range users {
+		if err := r.insert(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCreate reports the constraint a new user would violate. The caller
+// must hold the write lock.
+func (r *memoryUserRepository) checkCreate(user *models.User) error {
+	if user.ID != 0 {
+		if _, exists := r.users[user.ID]; exists {
+			return ErrDuplicate
+		}
+	}
+	if !user.DeletedAt.Valid && r.emailTaken(user.Email, user.ID) {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+// insert stores a user that passed checkCreate, filling in what the database
+// would generate. The caller must hold the write lock.
+func (r *memoryUserRepository) insert(user *models.User) error {
+	if err := user.BeforeSave(nil); err != nil {
+		return err
+	}
+	if err := user.BeforeCreate(nil); err != nil {
+		return err
+	}
+	if user.ID == 0 {
+		user.ID = r.nextID
+	}
+	if user.ID >= r.nextID {
+		r.nextID = user.ID + 1
+	}
+
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
+
+	r.users[user.ID] = cloneUser(*user)
+	return nil
+}
+
+func (r *memoryUserRepository) FindAll(ctx context.Context) ([]models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := r.filter(func(u models.User) bool { return !u.DeletedAt.Valid })
+	sortUsers(users, "created_at", "", true)
+	return users, nil
+}
+
+func (r *memoryUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	user = cloneUser(user)
+	return &user, nil
+}
+
+func (r *memoryUserRepository) Update(ctx context.Context, user *models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok || stored.DeletedAt.Valid || stored.Version != user.Version {
+		return ErrVersionConflict
+	}
+	if !user.DeletedAt.Valid && r.emailTaken(user.Email, user.ID) {
+		return ErrDuplicate
+	}
+
+	if err := user.BeforeSave(nil); err != nil {
+		return err
+	}
+	user.Version++
+	user.UpdatedAt = time.Now()
+
+	// Like the GORM update, associations are not written
+	updated := cloneUser(*user)
+	updated.Roles = stored.Roles
+	r.users[user.ID] = updated
+	return nil
+}
+
+func (r *memoryUserRepository) Delete(ctx context.Context, id, version uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	if user.Version != version {
+		return ErrVersionConflict
+	}
+
+	now := time.Now()
+	user.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	user.DeletedKey = id
+	user.Version++
+	user.UpdatedAt = now
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if !user.DeletedAt.Valid && user.Email == email {
+			user = cloneUser(user)
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepository) FindExistingEmails(ctx context.Context, emails []string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		wanted[email] = true
+	}
+
+	var existing []string
+	for _, user := range r.users {
+		if !user.DeletedAt.Valid && wanted[user.Email] {
+			existing = append(existing, user.Email)
+		}
+	}
+	return existing, nil
+}
+
+// Search matches text case-insensitively, as LIKE does under the default
+// MySQL and SQLite collations.
+func (r *memoryUserRepository) Search(ctx context.Context, filter models.UserFilter, page, size int, sortBy string, sortDesc bool) ([]models.User, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := r.filter(func(u models.User) bool {
+		return !u.DeletedAt.Valid && matchesFilter(u, filter)
+	})
+	sortUsers(users, sortBy, filter.Q, sortDesc)
+
+	return paginate(users, page, size), int64(len(users)), nil
+}
+
+func (r *memoryUserRepository) SearchKeyset(ctx context.Context, filter models.UserFilter, keyset Keyset) ([]models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := r.filter(func(u models.User) bool {
+		if u.DeletedAt.Valid || !matchesFilter(u, filter) {
+			return false
+		}
+		if keyset.Anchor == nil {
+			return true
+		}
+		c := compareUsers(&u, keyset.Anchor, keyset.SortBy, filter.Q, keyset.SortDesc)
+		return c > 0 && !keyset.Backward || c < 0 && keyset.Backward
+	})
+	sortUsers(users, keyset.SortBy, filter.Q, keyset.SortDesc)
+
+	if len(users) > keyset.Limit {
+		if keyset.Backward {
+			users = users[len(users)-keyset.Limit:]
+		} else {
+			users = users[:keyset.Limit]
+		}
+	}
+	return users, nil
+}
+
+// matchesFilter is the in-memory counterpart of userFilterScope.
+func matchesFilter(user models.User, filter models.UserFilter) bool {
+	contains := func(s, substr string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+	}
+
+	switch {
+	case filter.Name != "" && !contains(user.Name, filter.Name):
+		return false
+	case filter.Q != "" && !matchesText(user, filter.Q):
+		return false
+	case filter.Status != nil && user.Status != *filter.Status:
+		return false
+	case filter.MinAge != nil && user.Age < *filter.MinAge:
+		return false
+	case filter.MaxAge != nil && user.Age > *filter.MaxAge:
+		return false
+	case filter.CreatedFrom != nil && user.CreatedAt.Before(*filter.CreatedFrom):
+		return false
+	case filter.CreatedTo != nil && user.CreatedAt.After(*filter.CreatedTo):
+		return false
+	case filter.EmailDomain != "" && !strings.HasSuffix(strings.ToLower(user.Email), "@"+strings.ToLower(filter.EmailDomain)):
+		return false
+	case filter.PhonePrefix != "" && !strings.HasPrefix(user.Phone, filter.PhonePrefix):
+		return false
+	}
+	return true
+}
+
+// matchesText reports whether the free-text search q matches the user's
+// name, email or phone, or the pinyin of the name.
+func matchesText(user models.User, q string) bool {
+	text, key := searchText(q)
+	return strings.Contains(strings.ToLower(user.Name), text) ||
+		strings.Contains(strings.ToLower(user.Email), text) ||
+		strings.Contains(strings.ToLower(user.Phone), text) ||
+		strings.Contains(user.NamePinyin, key) ||
+		strings.HasPrefix(user.NameInitials, key)
+}
+
+func (r *memoryUserRepository) FindDeleted(ctx context.Context, page, size int) ([]models.User, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := r.filter(func(u models.User) bool { return u.DeletedAt.Valid })
+	sortUsers(users, "deleted_at", "", true)
+
+	return paginate(users, page, size), int64(len(users)), nil
+}
+
+func (r *memoryUserRepository) FindDeletedByID(ctx context.Context, id uint) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || !user.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	// The GORM lookup does not preload roles
+	user = cloneUser(user)
+	user.Roles = nil
+	return &user, nil
+}
+
+func (r *memoryUserRepository) Restore(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || !user.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	if r.emailTaken(user.Email, id) {
+		return ErrDuplicate
+	}
+
+	user.DeletedAt = gorm.DeletedAt{}
+	user.DeletedKey = 0
+	user.Version++
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) ([]models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := r.filter(func(u models.User) bool {
+		return u.DeletedAt.Valid && u.DeletedAt.Time.Before(cutoff)
+	})
+	for _, user := range users {
+		delete(r.users, user.ID)
+	}
+	return users, nil
+}
+
+// filter returns copies of the stored users that match keep, ordered by id.
+// Callers must hold the lock.
+func (r *memoryUserRepository) filter(keep func(models.User) bool) []models.User {
+	users := []models.User{}
+	for _, user := range r.users {
+		if keep(user) {
+			users = append(users, cloneUser(user))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+// compareUsers orders a and b by one of the columns Search accepts, or by
+// relevance to q, breaking ties by ascending id like the GORM queries do.
+func compareUsers(a, b *models.User, column, q string, desc bool) int {
+	var c int
+	switch column {
+	case SortRelevance:
+		c = cmp.Compare(Relevance(a, q), Relevance(b, q))
+	case "id":
+		c = cmp.Compare(a.ID, b.ID)
+	case "name":
+		c = strings.Compare(a.Name, b.Name)
+	case "email":
+		c = strings.Compare(a.Email, b.Email)
+	case "phone":
+		c = strings.Compare(a.Phone, b.Phone)
+	case "age":
+		c = cmp.Compare(a.Age, b.Age)
+	case "status":
+		c = cmp.Compare(a.Status, b.Status)
+	case "updated_at":
+		c = a.UpdatedAt.Compare(b.UpdatedAt)
+	case "deleted_at":
+		c = a.DeletedAt.Time.Compare(b.DeletedAt.Time)
+	default:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if desc {
+		c = -c
+	}
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	return c
+}
+
+func sortUsers(users []models.User, column, q string, desc bool) {
+	sort.Slice(users, func(i, j int) bool {
+		return compareUsers(&users[i], &users[j], column, q, desc) < 0
+	})
+}
+
+// paginate applies the same offset and limit as the GORM queries. A negative
+// size means no limit.
+func paginate(users []models.User, page, size int) []models.User {
+	offset := (page - 1) * size
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(users) {
+		return []models.User{}
+	}
+	users = users[offset:]
+	if size >= 0 && size < len(users) {
+		users = users[:size]
+	}
+	return users
+}
@@ -0,0 +1,164 @@
+package repositories
+
+import (
+	"context"
+	"hello/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MFARepository interface {
+	FindSecret(ctx context.Context, userID uint) (*models.MFASecret, error)
+	SaveSecret(ctx context.Context, secret *models.MFASecret) error
+	Confirm(ctx context.Context, userID uint, step int64, recoveryCodeHashes []string) error
+	UseStep(ctx context.Context, userID uint, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID uint, hash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID uint) (int64, error)
+	Delete(ctx context.Context, userID uint) error
+
+	CreateChallenge(ctx context.Context, challenge *models.MFAChallenge) error
+	FindChallengeByHash(ctx context.Context, hash string) (*models.MFAChallenge, error)
+	RecordChallengeAttempt(ctx context.Context, id uint, maxAttempts int) (bool, error)
+	MarkChallengeUsed(ctx context.Context, id uint) (bool, error)
+}
+
+type mfaRepository struct {
+	db *gorm.DB
+}
+
+func NewMFARepository(db *gorm.DB) MFARepository {
+	return &mfaRepository{db: db}
+}
+
+func (r *mfaRepository) FindSecret(ctx context.Context, userID uint) (*models.MFASecret, error) {
+	var secret models.MFASecret
+	err := dbFor(ctx, r.db).Where("user_id = ?", userID).First(&secret).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &secret, nil
+}
+
+// SaveSecret creates the user's enrollment or replaces a previous one.
+func (r *mfaRepository) SaveSecret(ctx context.Context, secret *models.MFASecret) error {
+	return dbFor(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "confirmed_at", "last_used_step", "updated_at"}),
+	}).Create(secret).Error
+}
+
+// Confirm enables a pending enrollment, records step as used and replaces
+// the user's recovery codes. It reports ErrNotFound when there is no pending
+// enrollment, so two concurrent confirmations cannot both succeed.
+func (r *mfaRepository) Confirm(ctx context.Context, userID uint, step int64, recoveryCodeHashes []string) error {
+	return dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.MFASecret{}).
+			Where("user_id = ? AND confirmed_at IS NULL", userID).
+			Updates(map[string]interface{}{"confirmed_at": time.Now(), "last_used_step": step})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.MFARecoveryCode, len(recoveryCodeHashes))
+		for i, hash := range recoveryCodeHashes {
+			codes[i] = models.MFARecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseStep records that the TOTP code of step was used. It reports false when
+// this or a later step was already used, so a code cannot be replayed.
+func (r *mfaRepository) UseStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	result := dbFor(ctx, r.db).Model(&models.MFASecret{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UseRecoveryCode consumes the matching unused recovery code. It reports
+// false when there is none.
+func (r *mfaRepository) UseRecoveryCode(ctx context.Context, userID uint, hash string) (bool, error) {
+	result := dbFor(ctx, r.db).Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes.
+func (r *mfaRepository) CountRecoveryCodes(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := dbFor(ctx, r.db).Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// Delete removes the user's enrollment together with their recovery codes
+// and outstanding login challenges.
+func (r *mfaRepository) Delete(ctx context.Context, userID uint) error {
+	return dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.MFAChallenge{}, &models.MFARecoveryCode{}, &models.MFASecret{}} {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CreateChallenge stores a new login challenge and drops expired ones.
+func (r *mfaRepository) CreateChallenge(ctx context.Context, challenge *models.MFAChallenge) error {
+	if err := dbFor(ctx, r.db).Where("expires_at < ?", time.Now()).Delete(&models.MFAChallenge{}).Error; err != nil {
+		return err
+	}
+	return dbFor(ctx, r.db).Create(challenge).Error
+}
+
+func (r *mfaRepository) FindChallengeByHash(ctx context.Context, hash string) (*models.MFAChallenge, error) {
+	var challenge models.MFAChallenge
+	err := dbFor(ctx, r.db).Where("token_hash = ?", hash).First(&challenge).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &challenge, nil
+}
+
+// RecordChallengeAttempt counts an attempt to verify the challenge. It
+// reports false when maxAttempts were already made or the challenge was
+// used, so concurrent guesses cannot exceed the limit.
+func (r *mfaRepository) RecordChallengeAttempt(ctx context.Context, id uint, maxAttempts int) (bool, error) {
+	result := dbFor(ctx, r.db).Model(&models.MFAChallenge{}).
+		Where("id = ? AND attempts < ? AND used_at IS NULL", id, maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// MarkChallengeUsed flags the challenge as consumed. It reports false when it
+// had already been used, so one password step cannot yield two logins.
+func (r *mfaRepository) MarkChallengeUsed(ctx context.Context, id uint) (bool, error) {
+	result := dbFor(ctx, r.db).Model(&models.MFAChallenge{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"context"
+	"hello/models"
+
+	"gorm.io/gorm"
+)
+
+type PasswordHistoryRepository interface {
+	Recent(ctx context.Context, userID uint, limit int) ([]string, error)
+	Add(ctx context.Context, userID uint, hash string, keep int) error
+}
+
+type passwordHistoryRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordHistoryRepository(db *gorm.DB) PasswordHistoryRepository {
+	return &passwordHistoryRepository{db: db}
+}
+
+// Recent returns the hashes of the user's latest replaced passwords, newest
+// first.
+func (r *passwordHistoryRepository) Recent(ctx context.Context, userID uint, limit int) ([]string, error) {
+	var hashes []string
+	err := dbFor(ctx, r.db).Model(&models.PreviousPassword{}).
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Limit(limit).
+		Pluck("password_hash", &hashes).Error
+	return hashes, err
+}
+
+// Add records a replaced password hash and drops all but the newest keep
+// entries of the user.
+func (r *passwordHistoryRepository) Add(ctx context.Context, userID uint, hash string, keep int) error {
+	entry := &models.PreviousPassword{UserID: userID, PasswordHash: hash}
+	if err := dbFor(ctx, r.db).Create(entry).Error; err != nil {
+		return err
+	}
+
+	var kept []uint
+	err := dbFor(ctx, r.db).Model(&models.PreviousPassword{}).
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Limit(keep).
+		Pluck("id", &kept).Error
+	if err != nil {
+		return err
+	}
+	return dbFor(ctx, r.db).Where("user_id = ? AND id NOT IN ?", userID, kept).Delete(&models.PreviousPassword{}).Error
+}
@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"context"
+	"hello/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, token *models.PasswordResetToken) error
+	FindByHash(ctx context.Context, hash string) (*models.PasswordResetToken, error)
+	MarkUsed(ctx context.Context, id uint) (bool, error)
+	InvalidateForUser(ctx context.Context, userID uint) error
+}
+
+type passwordResetRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetRepository(db *gorm.DB) PasswordResetRepository {
+	return &passwordResetRepository{db: db}
+}
+
+// Create stores a new token and drops expired ones.
+func (r *passwordResetRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	if err := dbFor(ctx, r.db).Where("expires_at < ?", time.Now()).Delete(&models.PasswordResetToken{}).Error; err != nil {
+		return err
+	}
+	return dbFor(ctx, r.db).Create(token).Error
+}
+
+func (r *passwordResetRepository) FindByHash(ctx context.Context, hash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	err := dbFor(ctx, r.db).Where("token_hash = ?", hash).First(&token).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+// MarkUsed flags the token as consumed. It reports false when it had already
+// been used, so a link cannot reset the password twice.
+func (r *passwordResetRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	result := dbFor(ctx, r.db).Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateForUser marks every unused token of the user as used.
+func (r *passwordResetRepository) InvalidateForUser(ctx context.Context, userID uint) error {
+	return dbFor(ctx, r.db).Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"hello/models"
+	"strings"
+
+	"gorm.io/gorm/clause"
+)
+
+// SortRelevance orders a search by how well users match its Q text, best
+// first. Ties, and searches without Q, fall back to ascending id.
+const SortRelevance = "relevance"
+
+// Relevance ranks how well user matches the search text q, lower being
+// better:
+//
+//	0  name equals q
+//	1  name starts with q
+//	2  pinyin or initials equal q ("zhangsan" or "zs" for 张三)
+//	3  pinyin or initials start with q
+//	4  name contains q
+//	5  pinyin contains q
+//	6  anything else, such as an email or phone match
+//
+// Text is compared case-insensitively and q's pinyin form ignores spaces.
+// There is no typo-tolerant tier: edit distance and trigram similarity have
+// no implementation shared by MySQL, Postgres and SQLite. relevanceExpr
+// computes the same rank in SQL.
+func Relevance(user *models.User, q string) int {
+	text, key := searchText(q)
+	name := strings.ToLower(user.Name)
+
+	switch {
+	case name == text:
+		return 0
+	case strings.HasPrefix(name, text):
+		return 1
+	case user.NamePinyin == key || user.NameInitials == key:
+		return 2
+	case strings.HasPrefix(user.NamePinyin, key) || strings.HasPrefix(user.NameInitials, key):
+		return 3
+	case strings.Contains(name, text):
+		return 4
+	case strings.Contains(user.NamePinyin, key):
+		return 5
+	}
+	return 6
+}
+
+func relevanceExpr(q string) clause.Expr {
+	text, key := searchText(q)
+	likeText, likeKey := likeEscaper.Replace(text), likeEscaper.Replace(key)
+
+	return clause.Expr{
+		SQL: "CASE" +
+			" WHEN LOWER(name) = ? THEN 0" +
+			" WHEN LOWER(name) LIKE ? ESCAPE '!' THEN 1" +
+			" WHEN name_pinyin = ? OR name_initials = ? THEN 2" +
+			" WHEN name_pinyin LIKE ? ESCAPE '!' OR name_initials LIKE ? ESCAPE '!' THEN 3" +
+			" WHEN LOWER(name) LIKE ? ESCAPE '!' THEN 4" +
+			" WHEN name_pinyin LIKE ? ESCAPE '!' THEN 5" +
+			" ELSE 6 END",
+		Vars: []interface{}{
+			text,
+			likeText + "%",
+			key, key,
+			likeKey + "%", likeKey + "%",
+			"%" + likeText + "%",
+			"%" + likeKey + "%",
+		},
+		WithoutParentheses: true,
+	}
+}
+
+// searchText returns q lowercased for matching names, and without spaces for
+// matching the pinyin columns.
+func searchText(q string) (text, key string) {
+	text = strings.ToLower(strings.TrimSpace(q))
+	return text, strings.Join(strings.Fields(text), "")
+}
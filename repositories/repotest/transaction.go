@@ -0,0 +1,108 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"hello/models"
+	"hello/repositories"
+	"testing"
+)
+
+// TestTransactor runs the Transactor conformance suite. newStore must return
+// an empty repository and a transactor covering it for every call.
+func TestTransactor(t *testing.T, newStore func(t *testing.T) (repositories.UserRepository, repositories.Transactor)) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repositories.UserRepository, tx repositories.Transactor)
+	}{
+		{"Commits", testTransactorCommits},
+		{"RollsBackOnError", testTransactorRollsBackOnError},
+		{"NestedJoinsOuter", testTransactorNestedJoinsOuter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, tx := newStore(t)
+			tt.run(t, repo, tx)
+		})
+	}
+}
+
+var errRollback = errors.New("roll back")
+
+func testTransactorCommits(t *testing.T, repo repositories.UserRepository, tx repositories.Transactor) {
+	var id uint
+	err := tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		user := &models.User{Name: "Alice", Email: "alice@example.com", Password: "hash", Status: 1}
+		if err := repo.Create(ctx, user); err != nil {
+			return err
+		}
+		id = user.ID
+
+		// Writes are visible inside the transaction
+		_, err := repo.FindByID(ctx, id)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+
+	if _, err := repo.FindByID(ctx, id); err != nil {
+		t.Fatalf("committed user not found: %v", err)
+	}
+}
+
+func testTransactorRollsBackOnError(t *testing.T, repo repositories.UserRepository, tx repositories.Transactor) {
+	alice := createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+
+	err := tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := repo.Create(ctx, &models.User{Name: "Bob", Email: "bob@example.com", Password: "hash", Status: 1}); err != nil {
+			return err
+		}
+		user, err := repo.FindByID(ctx, alice.ID)
+		if err != nil {
+			return err
+		}
+		user.Status = 0
+		if err := repo.Update(ctx, user); err != nil {
+			return err
+		}
+		if err := repo.Delete(ctx, user.ID, user.Version); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("err = %v, want the function's error", err)
+	}
+
+	if _, err := repo.FindByEmail(ctx, "bob@example.com"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("create was not rolled back: err = %v", err)
+	}
+	found, err := repo.FindByID(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("delete was not rolled back: %v", err)
+	}
+	if found.Status != 1 || found.Version != alice.Version {
+		t.Fatalf("update was not rolled back: status = %d, version = %d", found.Status, found.Version)
+	}
+}
+
+func testTransactorNestedJoinsOuter(t *testing.T, repo repositories.UserRepository, tx repositories.Transactor) {
+	err := tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := tx.WithinTransaction(ctx, func(ctx context.Context) error {
+			return repo.Create(ctx, &models.User{Name: "Alice", Email: "alice@example.com", Password: "hash", Status: 1})
+		})
+		if err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("err = %v, want the function's error", err)
+	}
+
+	if _, err := repo.FindByEmail(ctx, "alice@example.com"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("inner transaction committed on its own: err = %v", err)
+	}
+}
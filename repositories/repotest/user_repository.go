@@ -0,0 +1,729 @@
+// Package repotest holds conformance suites that every repository
+// implementation must pass, so the in-memory and GORM versions stay
+// interchangeable.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hello/models"
+	"hello/repositories"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestUserRepository runs the UserRepository conformance suite. newRepo must
+// return an empty repository for every call.
+func TestUserRepository(t *testing.T, newRepo func(t *testing.T) repositories.UserRepository) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo repositories.UserRepository)
+	}{
+		{"CreateAssignsIDAndVersion", testCreateAssignsIDAndVersion},
+		{"CreateRejectsDuplicateEmail", testCreateRejectsDuplicateEmail},
+		{"DeletedEmailCanBeReused", testDeletedEmailCanBeReused},
+		{"CreateBatchIsAllOrNothing", testCreateBatchIsAllOrNothing},
+		{"FindExistingEmails", testFindExistingEmails},
+		{"FindByIDAndEmail", testFindByIDAndEmail},
+		{"FindAllOrdersNewestFirst", testFindAllOrdersNewestFirst},
+		{"UpdateChecksVersion", testUpdateChecksVersion},
+		{"UpdateRejectsDuplicateEmail", testUpdateRejectsDuplicateEmail},
+		{"UpdateEmailVerifiedAt", testUpdateEmailVerifiedAt},
+		{"DeleteChecksVersion", testDeleteChecksVersion},
+		{"DeleteAndRestore", testDeleteAndRestore},
+		{"RestoreRejectsTakenEmail", testRestoreRejectsTakenEmail},
+		{"SearchByNameAndPaginates", testSearchByNameAndPaginates},
+		{"SearchSorts", testSearchSorts},
+		{"SearchCombinesFilters", testSearchCombinesFilters},
+		{"SearchKeysetWalksBothWays", testSearchKeysetWalksBothWays},
+		{"SearchMatchesPinyinByRelevance", testSearchMatchesPinyinByRelevance},
+		{"FindDeletedOrdersAndPaginates", testFindDeletedOrdersAndPaginates},
+		{"PurgeDeletedBefore", testPurgeDeletedBefore},
+		{"ConcurrentCreate", testConcurrentCreate},
+		{"CancelledContext", testCancelledContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepo(t))
+		})
+	}
+}
+
+var (
+	ctx      = context.Background()
+	baseTime = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func createUser(t *testing.T, repo repositories.UserRepository, name, email string, age int, createdAt time.Time) *models.User {
+	t.Helper()
+	user := &models.User{
+		Name:      name,
+		Email:     email,
+		Password:  "hash",
+		Age:       age,
+		Status:    1,
+		CreatedAt: createdAt,
+	}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("create %s: %v", email, err)
+	}
+	return user
+}
+
+func names(users []models.User) []string {
+	result := make([]string, 0, len(users))
+	for _, user := range users {
+		result = append(result, user.Name)
+	}
+	return result
+}
+
+func expectNames(t *testing.T, users []models.User, want ...string) {
+	t.Helper()
+	got := names(users)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got users %v, want %v", got, want)
+	}
+}
+
+func testCreateAssignsIDAndVersion(t *testing.T, repo repositories.UserRepository) {
+	first := createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+	second := createUser(t, repo, "Bob", "bob@example.com", 25, baseTime.Add(time.Hour))
+
+	if first.ID == 0 || second.ID <= first.ID {
+		t.Fatalf("ids not increasing: %d, %d", first.ID, second.ID)
+	}
+	if first.Version != 1 {
+		t.Fatalf("version = %d, want 1", first.Version)
+	}
+	if first.UpdatedAt.IsZero() {
+		t.Fatal("updated_at not set")
+	}
+}
+
+func testCreateRejectsDuplicateEmail(t *testing.T, repo repositories.UserRepository) {
+	createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+
+	err := repo.Create(ctx, &models.User{Name: "Other", Email: "alice@example.com", Password: "hash", Status: 1})
+	if !errors.Is(err, repositories.ErrDuplicate) {
+		t.Fatalf("err = %v, want repositories.ErrDuplicate", err)
+	}
+}
+
+func testDeletedEmailCanBeReused(t *testing.T, repo repositories.UserRepository) {
+	old := createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+	if err := repo.Delete(ctx, old.ID, old.Version); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	reused := createUser(t, repo, "Alice Again", "alice@example.com", 31, baseTime.Add(time.Hour))
+	found, err := repo.FindByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("find by email: %v", err)
+	}
+	if found.ID != reused.ID {
+		t.Fatalf("found user %d, want %d", found.ID, reused.ID)
+	}
+}
+
+func testCreateBatchIsAllOrNothing(t *testing.T, repo repositories.UserRepository) {
+	createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+
+	batch := func(emails ...string) []*models.User {
+		users := make([]*models.User, 0, len(emails))
+		for _, email := range emails {
+			users = append(users, &models.User{Name: email, Email: email, Password: "hash", Status: 1})
+		}
+		return users
+	}
+
+	for _, emails := range [][]string{
+		{"bob@example.com", "alice@example.com"},
+		{"bob@example.com", "carol@example.com", "bob@example.com"},
+	} {
+		if err := repo.CreateBatch(ctx, batch(emails...)); !errors.Is(err, repositories.ErrDuplicate) {
+			t.Fatalf("batch %v: err = %v, want repositories.ErrDuplicate", emails, err)
+		}
+		if _, err := repo.FindByEmail(ctx, "bob@example.com"); !errors.Is(err, repositories.ErrNotFound) {
+			t.Fatalf("batch %v was partly created: err = %v", emails, err)
+		}
+	}
+
+	users := batch("bob@example.com", "carol@example.com")
+	if err := repo.CreateBatch(ctx, users); err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	for _, user := range users {
+		if user.ID == 0 || user.Version != 1 {
+			t.Fatalf("%s: id = %d, version = %d", user.Email, user.ID, user.Version)
+		}
+		found, err := repo.FindByID(ctx, user.ID)
+		if err != nil || found.Email != user.Email {
+			t.Fatalf("find %d: %v, %+v", user.ID, err, found)
+		}
+	}
+}
+
+func testFindExistingEmails(t *testing.T, repo repositories.UserRepository) {
+	createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+	bob := createUser(t, repo, "Bob", "bob@example.com", 25, baseTime)
+	if err := repo.Delete(ctx, bob.ID, bob.Version); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	existing, err := repo.FindExistingEmails(ctx, []string{"alice@example.com", "bob@example.com", "carol@example.com"})
+	if err != nil {
+		t.Fatalf("find existing emails: %v", err)
+	}
+	if fmt.Sprint(existing) != "[alice@example.com]" {
+		t.Fatalf("existing = %v, want [alice@example.com]", existing)
+	}
+
+	if existing, err := repo.FindExistingEmails(ctx, nil); err != nil || len(existing) != 0 {
+		t.Fatalf("no emails: %v, %v", existing, err)
+	}
+}
+
+func testFindByIDAndEmail(t *testing.T, repo repositories.UserRepository) {
+	user := createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+
+	found, err := repo.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("find by id: %v", err)
+	}
+	if found.Email != user.Email || found.Age != 30 || found.Version != 1 {
+		t.Fatalf("unexpected user: %+v", found)
+	}
+
+	// Changes to a returned user must not leak into the repository
+	found.Name = "Changed"
+	again, _ := repo.FindByID(ctx, user.ID)
+	if again.Name != "Alice" {
+		t.Fatalf("name = %q, want Alice", again.Name)
+	}
+
+	if _, err := repo.FindByID(ctx, user.ID+100); !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("missing id: err = %v, want repositories.ErrNotFound", err)
+	}
+	if _, err := repo.FindByEmail(ctx, "nobody@example.com"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("missing email: err = %v, want repositories.ErrNotFound", err)
+	}
+}
+
+func testFindAllOrdersNewestFirst(t *testing.T, repo repositories.UserRepository) {
+	createUser(t, repo, "Middle", "middle@example.com", 20, baseTime.Add(time.Hour))
+	createUser(t, repo, "Oldest", "oldest@example.com", 20, baseTime)
+	createUser(t, repo, "Newest", "newest@example.com", 20, baseTime.Add(2*time.Hour))
+	deleted := createUser(t, repo, "Deleted", "deleted@example.com", 20, baseTime.Add(3*time.Hour))
+	if err := repo.Delete(ctx, deleted.ID, deleted.Version); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	users, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Fatalf("find all: %v", err)
+	}
+	expectNames(t, users, "Newest", "Middle", "Oldest")
+}
+
+func testUpdateChecksVersion(t *testing.T, repo repositories.UserRepository) {
+	user := createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+	stale := *user
+
+	user.Name = "Alice Updated"
+	if err := repo.Update(ctx, user); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if user.Version != 2 {
+		t.Fatalf("version = %d, want 2", user.Version)
+	}
+
+	stale.Name = "Lost Update"
+	if err := repo.Update(ctx, &stale); !errors.Is(err, repositories.ErrVersionConflict) {
+		t.Fatalf("stale update: err = %v, want ErrVersionConflict", err)
+	}
+	if stale.Version != 1 {
+		t.Fatalf("stale version = %d, want it left at 1", stale.Version)
+	}
+
+	found, _ := repo.FindByID(ctx, user.ID)
+	if found.Name != "Alice Updated" || found.Version != 2 {
+		t.Fatalf("unexpected user after update: %+v", found)
+	}
+}
+
+func testUpdateRejectsDuplicateEmail(t *testing.T, repo repositories.UserRepository) {
+	createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+	bob := createUser(t, repo, "Bob", "bob@example.com", 25, baseTime)
+
+	bob.Email = "alice@example.com"
+	if err := repo.Update(ctx, bob); !errors.Is(err, repositories.ErrDuplicate) {
+		t.Fatalf("err = %v, want repositories.ErrDuplicate", err)
+	}
+}
+
+func testUpdateEmailVerifiedAt(t *testing.T, repo repositories.UserRepository) {
+	user := createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+	if user.EmailVerified() {
+		t.Fatal("new user is verified")
+	}
+
+	verifiedAt := baseTime.Add(time.Hour)
+	user.EmailVerifiedAt = &verifiedAt
+	if err := repo.Update(ctx, user); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	found, _ := repo.FindByID(ctx, user.ID)
+	if found.EmailVerifiedAt == nil || !found.EmailVerifiedAt.Equal(verifiedAt) {
+		t.Fatalf("email_verified_at = %v, want %v", found.EmailVerifiedAt, verifiedAt)
+	}
+
+	found.EmailVerifiedAt = nil
+	if err := repo.Update(ctx, found); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	found, _ = repo.FindByID(ctx, user.ID)
+	if found.EmailVerified() {
+		t.Fatalf("email_verified_at = %v, want it cleared", found.EmailVerifiedAt)
+	}
+}
+
+func testDeleteChecksVersion(t *testing.T, repo repositories.UserRepository) {
+	user := createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+	stale := *user
+
+	user.Name = "Alice Updated"
+	if err := repo.Update(ctx, user); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := repo.Delete(ctx, stale.ID, stale.Version); !errors.Is(err, repositories.ErrVersionConflict) {
+		t.Fatalf("stale delete: err = %v, want ErrVersionConflict", err)
+	}
+	if _, err := repo.FindByID(ctx, user.ID); err != nil {
+		t.Fatalf("user was deleted by a stale delete: %v", err)
+	}
+
+	if err := repo.Delete(ctx, user.ID, user.Version); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+}
+
+func testDeleteAndRestore(t *testing.T, repo repositories.UserRepository) {
+	user := createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+
+	if err := repo.Delete(ctx, user.ID, user.Version); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := repo.Delete(ctx, user.ID, user.Version); !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("second delete: err = %v, want repositories.ErrNotFound", err)
+	}
+	if _, err := repo.FindByID(ctx, user.ID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("find deleted: err = %v, want repositories.ErrNotFound", err)
+	}
+	if _, err := repo.FindByEmail(ctx, user.Email); !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("find deleted by email: err = %v, want repositories.ErrNotFound", err)
+	}
+
+	deleted, err := repo.FindDeletedByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("find deleted by id: %v", err)
+	}
+	if !deleted.DeletedAt.Valid || deleted.Version != 2 {
+		t.Fatalf("unexpected deleted user: %+v", deleted)
+	}
+
+	if err := repo.Restore(ctx, user.ID); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if err := repo.Restore(ctx, user.ID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("second restore: err = %v, want repositories.ErrNotFound", err)
+	}
+
+	restored, err := repo.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("find restored: %v", err)
+	}
+	if restored.DeletedAt.Valid || restored.Version != 3 {
+		t.Fatalf("unexpected restored user: %+v", restored)
+	}
+	if _, err := repo.FindDeletedByID(ctx, user.ID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("find restored as deleted: err = %v, want repositories.ErrNotFound", err)
+	}
+}
+
+func testRestoreRejectsTakenEmail(t *testing.T, repo repositories.UserRepository) {
+	old := createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+	if err := repo.Delete(ctx, old.ID, old.Version); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	createUser(t, repo, "New Alice", "alice@example.com", 30, baseTime)
+
+	if err := repo.Restore(ctx, old.ID); !errors.Is(err, repositories.ErrDuplicate) {
+		t.Fatalf("err = %v, want repositories.ErrDuplicate", err)
+	}
+}
+
+func testSearchByNameAndPaginates(t *testing.T, repo repositories.UserRepository) {
+	for i := 1; i <= 5; i++ {
+		createUser(t, repo, fmt.Sprintf("Member %d", i), fmt.Sprintf("member%d@example.com", i), 20+i, baseTime.Add(time.Duration(i)*time.Hour))
+	}
+	createUser(t, repo, "Outsider", "outsider@example.com", 40, baseTime)
+	deleted := createUser(t, repo, "Member 6", "member6@example.com", 26, baseTime.Add(6*time.Hour))
+	if err := repo.Delete(ctx, deleted.ID, deleted.Version); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	users, total, err := repo.Search(ctx, models.UserFilter{Name: "Member"}, 1, 2, "created_at", true)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if total != 5 {
+		t.Fatalf("total = %d, want 5", total)
+	}
+	expectNames(t, users, "Member 5", "Member 4")
+
+	users, _, _ = repo.Search(ctx, models.UserFilter{Name: "Member"}, 3, 2, "created_at", true)
+	expectNames(t, users, "Member 1")
+
+	users, total, _ = repo.Search(ctx, models.UserFilter{Name: "Member"}, 4, 2, "created_at", true)
+	if total != 5 || len(users) != 0 {
+		t.Fatalf("past last page: got %d users, total %d", len(users), total)
+	}
+
+	users, total, _ = repo.Search(ctx, models.UserFilter{}, 1, 10, "created_at", true)
+	if total != 6 || len(users) != 6 {
+		t.Fatalf("empty filter: got %d users, total %d, want 6", len(users), total)
+	}
+
+	users, total, _ = repo.Search(ctx, models.UserFilter{Name: "ember 3"}, 1, 10, "created_at", true)
+	if total != 1 {
+		t.Fatalf("substring match: total = %d, want 1", total)
+	}
+	expectNames(t, users, "Member 3")
+}
+
+func testSearchSorts(t *testing.T, repo repositories.UserRepository) {
+	createUser(t, repo, "Carol", "carol@example.com", 35, baseTime)
+	createUser(t, repo, "Alice", "alice@example.com", 30, baseTime.Add(2*time.Hour))
+	createUser(t, repo, "Bob", "bob@example.com", 40, baseTime.Add(time.Hour))
+
+	cases := []struct {
+		sortBy string
+		desc   bool
+		want   []string
+	}{
+		{"name", false, []string{"Alice", "Bob", "Carol"}},
+		{"name", true, []string{"Carol", "Bob", "Alice"}},
+		{"age", false, []string{"Alice", "Carol", "Bob"}},
+		{"age", true, []string{"Bob", "Carol", "Alice"}},
+		{"email", false, []string{"Alice", "Bob", "Carol"}},
+		{"id", false, []string{"Carol", "Alice", "Bob"}},
+		{"id", true, []string{"Bob", "Alice", "Carol"}},
+		{"created_at", false, []string{"Carol", "Bob", "Alice"}},
+		{"created_at", true, []string{"Alice", "Bob", "Carol"}},
+	}
+	for _, c := range cases {
+		users, _, err := repo.Search(ctx, models.UserFilter{}, 1, 10, c.sortBy, c.desc)
+		if err != nil {
+			t.Fatalf("search sorted by %s: %v", c.sortBy, err)
+		}
+		if fmt.Sprint(names(users)) != fmt.Sprint(c.want) {
+			t.Errorf("sort by %s desc=%v: got %v, want %v", c.sortBy, c.desc, names(users), c.want)
+		}
+	}
+}
+
+func testSearchCombinesFilters(t *testing.T, repo repositories.UserRepository) {
+	seed := []struct {
+		name, email, phone string
+		age, status        int
+		createdAt          time.Time
+	}{
+		{"Alice", "alice@corp.example", "13800000001", 25, 1, baseTime},
+		{"Bob", "bob@corp.example", "13900000002", 35, 1, baseTime.Add(24 * time.Hour)},
+		{"Carol", "carol@mail.example", "13800000003", 45, 0, baseTime.Add(48 * time.Hour)},
+		{"Dave", "dave@corp.example", "15000000004", 55, 0, baseTime.Add(72 * time.Hour)},
+		{"Eve_1", "eve@mail.example", "13800000005", 30, 1, baseTime.Add(96 * time.Hour)},
+	}
+	for _, u := range seed {
+		user := &models.User{Name: u.name, Email: u.email, Password: "hash", Phone: u.phone, Age: u.age, Status: u.status, CreatedAt: u.createdAt}
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("create %s: %v", u.email, err)
+		}
+	}
+
+	intPtr := func(v int) *int { return &v }
+	timePtr := func(v time.Time) *time.Time { return &v }
+
+	cases := []struct {
+		name   string
+		filter models.UserFilter
+		want   []string
+	}{
+		{"status", models.UserFilter{Status: intPtr(0)}, []string{"Carol", "Dave"}},
+		{"age range", models.UserFilter{MinAge: intPtr(30), MaxAge: intPtr(45)}, []string{"Bob", "Carol", "Eve_1"}},
+		{"created range", models.UserFilter{CreatedFrom: timePtr(baseTime.Add(24 * time.Hour)), CreatedTo: timePtr(baseTime.Add(72 * time.Hour))}, []string{"Bob", "Carol", "Dave"}},
+		{"email domain", models.UserFilter{EmailDomain: "corp.example"}, []string{"Alice", "Bob", "Dave"}},
+		{"phone prefix", models.UserFilter{PhonePrefix: "138"}, []string{"Alice", "Carol", "Eve_1"}},
+		{"q matches name", models.UserFilter{Q: "caro"}, []string{"Carol"}},
+		{"q matches email", models.UserFilter{Q: "mail.example"}, []string{"Carol", "Eve_1"}},
+		{"q matches phone", models.UserFilter{Q: "0000002"}, []string{"Bob"}},
+		{"wildcards are literal", models.UserFilter{Name: "_"}, []string{"Eve_1"}},
+		{"name ignores case", models.UserFilter{Name: "aLI"}, []string{"Alice"}},
+		{"q ignores case", models.UserFilter{Q: "MAIL.Example"}, []string{"Carol", "Eve_1"}},
+		{"email domain ignores case", models.UserFilter{EmailDomain: "Mail.EXAMPLE"}, []string{"Carol", "Eve_1"}},
+		{"combined", models.UserFilter{Status: intPtr(1), EmailDomain: "corp.example", PhonePrefix: "138"}, []string{"Alice"}},
+		{"no match", models.UserFilter{Status: intPtr(0), MaxAge: intPtr(40)}, []string{}},
+	}
+	for _, c := range cases {
+		users, total, err := repo.Search(ctx, c.filter, 1, 2, "created_at", false)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if total != int64(len(c.want)) {
+			t.Errorf("%s: total = %d, want %d", c.name, total, len(c.want))
+		}
+		if want := c.want[:min(2, len(c.want))]; fmt.Sprint(names(users)) != fmt.Sprint(want) {
+			t.Errorf("%s: got %v, want %v", c.name, names(users), want)
+		}
+	}
+}
+
+func testSearchKeysetWalksBothWays(t *testing.T, repo repositories.UserRepository) {
+	// Repeated ages and creation times make the id tie-break matter
+	for i := 1; i <= 7; i++ {
+		createUser(t, repo, fmt.Sprintf("User %d", i), fmt.Sprintf("user%d@example.com", i), 20+i%3, baseTime.Add(time.Duration(i/2)*time.Hour))
+	}
+	createUser(t, repo, "Other", "other@example.com", 20, baseTime)
+	filter := models.UserFilter{Name: "User"}
+
+	for _, sortBy := range []string{"age", "created_at", "id", "name"} {
+		for _, desc := range []bool{false, true} {
+			want, _, err := repo.Search(ctx, filter, 1, 100, sortBy, desc)
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+
+			var forward []models.User
+			var anchor *models.User
+			for {
+				page, err := repo.SearchKeyset(ctx, filter, repositories.Keyset{SortBy: sortBy, SortDesc: desc, Anchor: anchor, Limit: 3})
+				if err != nil {
+					t.Fatalf("keyset forward: %v", err)
+				}
+				if len(page) == 0 {
+					break
+				}
+				forward = append(forward, page...)
+				anchor = &page[len(page)-1]
+			}
+			if fmt.Sprint(names(forward)) != fmt.Sprint(names(want)) {
+				t.Errorf("forward by %s desc=%v: got %v, want %v", sortBy, desc, names(forward), names(want))
+			}
+
+			var backward []models.User
+			anchor = nil
+			for {
+				page, err := repo.SearchKeyset(ctx, filter, repositories.Keyset{SortBy: sortBy, SortDesc: desc, Anchor: anchor, Backward: true, Limit: 3})
+				if err != nil {
+					t.Fatalf("keyset backward: %v", err)
+				}
+				if len(page) == 0 {
+					break
+				}
+				backward = append(append([]models.User(nil), page...), backward...)
+				anchor = &page[0]
+			}
+			if fmt.Sprint(names(backward)) != fmt.Sprint(names(want)) {
+				t.Errorf("backward by %s desc=%v: got %v, want %v", sortBy, desc, names(backward), names(want))
+			}
+		}
+	}
+}
+
+func testSearchMatchesPinyinByRelevance(t *testing.T, repo repositories.UserRepository) {
+	createUser(t, repo, "张三", "zhangsan@example.com", 30, baseTime)
+	createUser(t, repo, "张三丰", "sanfeng@example.com", 30, baseTime)
+	renamed := createUser(t, repo, "李张", "lizhang@example.com", 30, baseTime)
+	createUser(t, repo, "Zhang Wei", "wei@example.com", 30, baseTime)
+	createUser(t, repo, "王五", "zs@example.com", 30, baseTime)
+
+	search := func(q string) []string {
+		t.Helper()
+		users, total, err := repo.Search(ctx, models.UserFilter{Q: q}, 1, 10, repositories.SortRelevance, false)
+		if err != nil {
+			t.Fatalf("search %q: %v", q, err)
+		}
+		if total != int64(len(users)) {
+			t.Fatalf("search %q: total = %d, want %d", q, total, len(users))
+		}
+		return names(users)
+	}
+
+	cases := []struct {
+		q    string
+		want []string
+	}{
+		{"zhangsan", []string{"张三", "张三丰"}},
+		{"zhang san", []string{"张三", "张三丰"}},
+		{"ZS", []string{"张三", "张三丰", "王五"}},
+		{"zhang", []string{"Zhang Wei", "张三", "张三丰", "李张"}},
+		{"张三", []string{"张三", "张三丰"}},
+	}
+	for _, c := range cases {
+		if got := search(c.q); fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("search %q: got %v, want %v", c.q, got, c.want)
+		}
+	}
+
+	var walked []models.User
+	var anchor *models.User
+	for {
+		page, err := repo.SearchKeyset(ctx, models.UserFilter{Q: "zhang"}, repositories.Keyset{SortBy: repositories.SortRelevance, Anchor: anchor, Limit: 1})
+		if err != nil {
+			t.Fatalf("keyset: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		walked = append(walked, page...)
+		anchor = &page[0]
+	}
+	expectNames(t, walked, "Zhang Wei", "张三", "张三丰", "李张")
+
+	// The pinyin follows the name on update
+	renamed.Name = "赵六"
+	if err := repo.Update(ctx, renamed); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	got, err := repo.FindByID(ctx, renamed.ID)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if got.NamePinyin != "zhaoliu" || got.NameInitials != "zl" {
+		t.Errorf("pinyin = %q/%q, want zhaoliu/zl", got.NamePinyin, got.NameInitials)
+	}
+	if got := search("zl"); fmt.Sprint(got) != "[赵六]" {
+		t.Errorf("search zl: got %v, want [赵六]", got)
+	}
+}
+
+func testFindDeletedOrdersAndPaginates(t *testing.T, repo repositories.UserRepository) {
+	createUser(t, repo, "Active", "active@example.com", 30, baseTime)
+	for _, name := range []string{"First", "Second", "Third"} {
+		user := createUser(t, repo, name, name+"@example.com", 30, baseTime)
+		if err := repo.Delete(ctx, user.ID, user.Version); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		// Keep deleted_at distinct on stores with coarse timestamps
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	users, total, err := repo.FindDeleted(ctx, 1, 2)
+	if err != nil {
+		t.Fatalf("find deleted: %v", err)
+	}
+	if total != 3 {
+		t.Fatalf("total = %d, want 3", total)
+	}
+	expectNames(t, users, "Third", "Second")
+
+	users, _, _ = repo.FindDeleted(ctx, 2, 2)
+	expectNames(t, users, "First")
+}
+
+func testPurgeDeletedBefore(t *testing.T, repo repositories.UserRepository) {
+	active := createUser(t, repo, "Active", "active@example.com", 30, baseTime)
+	deleted := createUser(t, repo, "Deleted", "deleted@example.com", 30, baseTime)
+	if err := repo.Delete(ctx, deleted.ID, deleted.Version); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	purged, err := repo.PurgeDeletedBefore(ctx, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if len(purged) != 0 {
+		t.Fatalf("purged %d users before the retention window, want 0", len(purged))
+	}
+
+	purged, err = repo.PurgeDeletedBefore(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	expectNames(t, purged, "Deleted")
+
+	if _, err := repo.FindDeletedByID(ctx, deleted.ID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("find purged: err = %v, want repositories.ErrNotFound", err)
+	}
+	if _, err := repo.FindByID(ctx, active.ID); err != nil {
+		t.Fatalf("active user was purged: %v", err)
+	}
+}
+
+func testConcurrentCreate(t *testing.T, repo repositories.UserRepository) {
+	const workers = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Every worker races for the same address plus one of its own
+			shared := &models.User{Name: "Shared", Email: "shared@example.com", Password: "hash", Status: 1}
+			if err := repo.Create(ctx, shared); err != nil && !errors.Is(err, repositories.ErrDuplicate) {
+				errs <- err
+			}
+			own := &models.User{Name: "Worker", Email: fmt.Sprintf("worker%d@example.com", i), Password: "hash", Status: 1}
+			if err := repo.Create(ctx, own); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("concurrent create: %v", err)
+	}
+
+	users, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Fatalf("find all: %v", err)
+	}
+	if len(users) != workers+1 {
+		t.Fatalf("got %d users, want %d", len(users), workers+1)
+	}
+}
+
+func testCancelledContext(t *testing.T, repo repositories.UserRepository) {
+	user := createUser(t, repo, "Alice", "alice@example.com", 30, baseTime)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := repo.FindByID(cancelled, user.ID); !errors.Is(err, context.Canceled) {
+		t.Fatalf("find by id: err = %v, want context.Canceled", err)
+	}
+	if _, err := repo.SearchKeyset(cancelled, models.UserFilter{}, repositories.Keyset{SortBy: "id", Limit: 10}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("search keyset: err = %v, want context.Canceled", err)
+	}
+	if _, _, err := repo.Search(cancelled, models.UserFilter{}, 1, 10, "created_at", true); !errors.Is(err, context.Canceled) {
+		t.Fatalf("search: err = %v, want context.Canceled", err)
+	}
+	err := repo.Create(cancelled, &models.User{Name: "Bob", Email: "bob@example.com", Password: "hash", Status: 1})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("create: err = %v, want context.Canceled", err)
+	}
+	err = repo.CreateBatch(cancelled, []*models.User{{Name: "Bob", Email: "bob@example.com", Password: "hash", Status: 1}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("create batch: err = %v, want context.Canceled", err)
+	}
+	if _, err := repo.FindByEmail(ctx, "bob@example.com"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Fatalf("user created despite cancelled context: err = %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"context"
+	"hello/models"
+
+	"gorm.io/gorm"
+)
+
+type RoleRepository interface {
+	FindAll(ctx context.Context) ([]models.Role, error)
+	FindByName(ctx context.Context, name string) (*models.Role, error)
+	FindByNames(ctx context.Context, names []string) ([]models.Role, error)
+	FindByUserID(ctx context.Context, userID uint) ([]models.Role, error)
+	EnsureRole(ctx context.Context, name, description string, permissions []string) error
+	AddUserRole(ctx context.Context, userID uint, role *models.Role) error
+	RemoveUserRole(ctx context.Context, userID uint, role *models.Role) error
+}
+
+type roleRepository struct {
+	db *gorm.DB
+}
+
+func NewRoleRepository(db *gorm.DB) RoleRepository {
+	return &roleRepository{db: db}
+}
+
+func (r *roleRepository) FindAll(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	err := dbFor(ctx, r.db).Preload("Permissions").Order("id ASC").Find(&roles).Error
+	return roles, err
+}
+
+func (r *roleRepository) FindByName(ctx context.Context, name string) (*models.Role, error) {
+	var role models.Role
+	err := dbFor(ctx, r.db).Preload("Permissions").Where("name = ?", name).First(&role).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &role, nil
+}
+
+func (r *roleRepository) FindByNames(ctx context.Context, names []string) ([]models.Role, error) {
+	var roles []models.Role
+	if len(names) == 0 {
+		return roles, nil
+	}
+	err := dbFor(ctx, r.db).Preload("Permissions").Where("name IN ?", names).Find(&roles).Error
+	return roles, err
+}
+
+func (r *roleRepository) FindByUserID(ctx context.Context, userID uint) ([]models.Role, error) {
+	var roles []models.Role
+	err := dbFor(ctx, r.db).Model(&models.User{ID: userID}).Association("Roles").Find(&roles)
+	return roles, err
+}
+
+// EnsureRole creates the role and any missing permissions, then grants them
+// to the role. Permissions granted by hand are left untouched.
+func (r *roleRepository) EnsureRole(ctx context.Context, name, description string, permissions []string) error {
+	return dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		role := models.Role{Name: name}
+		if err := tx.Where(&role).Attrs(models.Role{Description: description}).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+
+		perms := make([]models.Permission, 0, len(permissions))
+		for _, name := range permissions {
+			perm := models.Permission{Name: name}
+			if err := tx.Where(&perm).FirstOrCreate(&perm).Error; err != nil {
+				return err
+			}
+			perms = append(perms, perm)
+		}
+
+		if len(perms) == 0 {
+			return nil
+		}
+		return tx.Model(&role).Association("Permissions").Append(perms)
+	})
+}
+
+func (r *roleRepository) AddUserRole(ctx context.Context, userID uint, role *models.Role) error {
+	return dbFor(ctx, r.db).Model(&models.User{ID: userID}).Association("Roles").Append(role)
+}
+
+func (r *roleRepository) RemoveUserRole(ctx context.Context, userID uint, role *models.Role) error {
+	return dbFor(ctx, r.db).Model(&models.User{ID: userID}).Association("Roles").Delete(role)
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Transactor runs a function in a transaction. Repository calls made with the
+// context passed to fn take part in it: they are committed together when fn
+// returns nil and rolled back when it returns an error. A call made inside
+// another transaction joins the outer one.
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+type gormTransactor struct {
+	db *gorm.DB
+}
+
+func NewTransactor(db *gorm.DB) Transactor {
+	return &gormTransactor{db: db}
+}
+
+func (t *gormTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return fn(ctx)
+	}
+	return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// dbFor returns the transaction ctx carries, or db when there is none, bound
+// to ctx. GORM repositories start every query from it.
+func dbFor(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
+
+type memoryTransactor struct {
+	users *memoryUserRepository
+}
+
+// NewMemoryTransactor returns a Transactor for a repository created by
+// NewMemoryUserRepository. A failed function restores the repository to its
+// state before the call. Unlike a database transaction, concurrent callers
+// see the changes before they are committed.
+func NewMemoryTransactor(users UserRepository) Transactor {
+	return &memoryTransactor{users: users.(*memoryUserRepository)}
+}
+
+func (t *memoryTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	restore := t.users.snapshot()
+	if err := fn(context.WithValue(ctx, txKey{}, t)); err != nil {
+		restore()
+		return err
+	}
+	return nil
+}
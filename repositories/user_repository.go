@@ -1,20 +1,44 @@
 package repositories
 
 import (
+	"context"
 	"hello/models"
+	"slices"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
 type UserRepository interface {
-	Create(user *models.User) error
-	FindAll() ([]models.User, error)
-	FindByID(id uint) (*models.User, error)
-	Update(user *models.User) error
-	Delete(id uint) error
-	FindByEmail(email string) (*models.User, error)
-	SearchByName(name string, page, size int, sortBy string, sortDesc bool) ([]models.User, int64, error)
+	Create(ctx context.Context, user *models.User) error
+	CreateBatch(ctx context.Context, users []*models.User) error
+	FindAll(ctx context.Context) ([]models.User, error)
+	FindByID(ctx context.Context, id uint) (*models.User, error)
+	Update(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, id, version uint) error
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	FindExistingEmails(ctx context.Context, emails []string) ([]string, error)
+	Search(ctx context.Context, filter models.UserFilter, page, size int, sortBy string, sortDesc bool) ([]models.User, int64, error)
+	SearchKeyset(ctx context.Context, filter models.UserFilter, keyset Keyset) ([]models.User, error)
+	FindDeleted(ctx context.Context, page, size int) ([]models.User, int64, error)
+	FindDeletedByID(ctx context.Context, id uint) (*models.User, error)
+	Restore(ctx context.Context, id uint) error
+	PurgeDeletedBefore(ctx context.Context, cutoff time.Time) ([]models.User, error)
+}
+
+// Keyset selects up to Limit users positioned after Anchor in the listing
+// ordered by SortBy (ties broken by ascending id), or before it when Backward
+// is set. Only the SortBy column and ID of Anchor are used; a nil Anchor
+// starts from the first row, or the last when Backward is set. Users are
+// always returned in listing order.
+type Keyset struct {
+	SortBy   string
+	SortDesc bool
+	Anchor   *models.User
+	Backward bool
+	Limit    int
 }
 
 type userRepository struct {
@@ -25,61 +49,310 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-func (r *userRepository) Create(user *models.User) error {
-	return r.db.Create(user).Error
+func (r *userRepository) Create(ctx context.Context, user *models.User) error {
+	return translateError(dbFor(ctx, r.db).Create(user).Error)
+}
+
+// createBatchSize bounds the rows per INSERT statement in CreateBatch.
+const createBatchSize = 100
+
+// CreateBatch inserts the users in one transaction: either all of them are
+// created or, on any error such as a duplicate email, none are.
+func (r *userRepository) CreateBatch(ctx context.Context, users []*models.User) error {
+	err := dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(users, createBatchSize).Error
+	})
+	return translateError(err)
 }
 
-func (r *userRepository) FindAll() ([]models.User, error) {
+func (r *userRepository) FindAll(ctx context.Context) ([]models.User, error) {
 	var users []models.User
-	err := r.db.Order("created_at DESC").Find(&users).Error
+	err := dbFor(ctx, r.db).Preload("Roles").Order("created_at DESC").Find(&users).Error
 	return users, err
 }
 
-func (r *userRepository) FindByID(id uint) (*models.User, error) {
+func (r *userRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
 	var user models.User
-	err := r.db.First(&user, id).Error
+	err := dbFor(ctx, r.db).Preload("Roles").First(&user, id).Error
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 	return &user, nil
 }
 
-func (r *userRepository) Update(user *models.User) error {
-	return r.db.Save(user).Error
+// Update writes every column of the user, provided the row still has the
+// version the caller loaded, and bumps the version on success.
+func (r *userRepository) Update(ctx context.Context, user *models.User) error {
+	expected := user.Version
+	user.Version++
+
+	result := dbFor(ctx, r.db).Model(user).Select("*").Omit(clause.Associations).
+		Where("version = ?", expected).Updates(user)
+	if result.Error != nil {
+		user.Version = expected
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		user.Version = expected
+		return ErrVersionConflict
+	}
+	return nil
 }
 
-func (r *userRepository) Delete(id uint) error {
-	return r.db.Delete(&models.User{}, id).Error
+// Delete soft-deletes the user if it is still at version. It returns
+// ErrNotFound when the user does not exist or is already deleted, and
+// ErrVersionConflict when it has a different version. Role
+// assignments are kept so a restore brings the account back exactly as it
+// was.
+func (r *userRepository) Delete(ctx context.Context, id, version uint) error {
+	result := dbFor(ctx, r.db).Model(&models.User{}).Where("id = ? AND version = ?", id, version).Updates(map[string]interface{}{
+		"deleted_at":  time.Now(),
+		"deleted_key": id,
+		"version":     gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := dbFor(ctx, r.db).Model(&models.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrVersionConflict
+	}
+	return nil
 }
 
-func (r *userRepository) FindByEmail(email string) (*models.User, error) {
+func (r *userRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	err := r.db.Where("email = ?", email).First(&user).Error
+	err := dbFor(ctx, r.db).Preload("Roles").Where("email = ?", email).First(&user).Error
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 	return &user, nil
 }
 
-func (r *userRepository) SearchByName(name string, page, size int, sortBy string, sortDesc bool) ([]models.User, int64, error) {
+// FindExistingEmails returns those of emails already used by an active user.
+func (r *userRepository) FindExistingEmails(ctx context.Context, emails []string) ([]string, error) {
+	var existing []string
+	for chunk := range slices.Chunk(emails, 500) {
+		var found []string
+		err := dbFor(ctx, r.db).Model(&models.User{}).Where("email IN ?", chunk).Pluck("email", &found).Error
+		if err != nil {
+			return nil, err
+		}
+		existing = append(existing, found...)
+	}
+	return existing, nil
+}
+
+func (r *userRepository) Search(ctx context.Context, filter models.UserFilter, page, size int, sortBy string, sortDesc bool) ([]models.User, int64, error) {
 	var users []models.User
 	var total int64
 
-	query := r.db.Model(&models.User{})
-	if name != "" {
-		query = query.Where("name LIKE ?", "%"+name+"%")
+	// Both queries start from the same filtered session so the total always
+	// describes the rows being paged through
+	query := dbFor(ctx, r.db).Model(&models.User{}).Scopes(userFilterScope(filter)).Session(&gorm.Session{})
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := userOrder(sortKey(sortBy, filter.Q), sortDesc, false)
+	offset := (page - 1) * size
+	err := query.Preload("Roles").Clauses(order).Limit(size).Offset(offset).Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func (r *userRepository) SearchKeyset(ctx context.Context, filter models.UserFilter, keyset Keyset) ([]models.User, error) {
+	var users []models.User
+
+	// Walking backward reads the listing in reverse, then flips the result
+	desc := keyset.SortDesc != keyset.Backward
+	key := sortKey(keyset.SortBy, filter.Q)
+	id := clause.Column{Name: "id"}
+
+	query := dbFor(ctx, r.db).Model(&models.User{}).Scopes(userFilterScope(filter))
+	if keyset.Anchor != nil {
+		columnOp, idOp := ">", ">"
+		if desc {
+			columnOp = "<"
+		}
+		if keyset.Backward {
+			idOp = "<"
+		}
+		value := sortValue(keyset.Anchor, keyset.SortBy, filter.Q)
+		query = query.Where("? "+columnOp+" ? OR (? = ? AND ? "+idOp+" ?)",
+			key, value, key, value, id, keyset.Anchor.ID)
+	}
+
+	err := query.Preload("Roles").Clauses(userOrder(key, desc, keyset.Backward)).
+		Limit(keyset.Limit).Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if keyset.Backward {
+		slices.Reverse(users)
+	}
+	return users, nil
+}
+
+// sortKey returns what a listing sorted by sortBy orders on.
+func sortKey(sortBy, q string) interface{} {
+	if sortBy == SortRelevance {
+		return relevanceExpr(q)
+	}
+	return clause.Column{Name: sortBy}
+}
+
+// sortValue returns the value sortKey has for user.
+func sortValue(user *models.User, sortBy, q string) interface{} {
+	switch sortBy {
+	case SortRelevance:
+		return Relevance(user, q)
+	case "id":
+		return user.ID
+	case "name":
+		return user.Name
+	case "email":
+		return user.Email
+	case "phone":
+		return user.Phone
+	case "age":
+		return user.Age
+	case "status":
+		return user.Status
+	case "updated_at":
+		return user.UpdatedAt
+	default:
+		return user.CreatedAt
+	}
+}
+
+// userOrder orders by key and then by id.
+func userOrder(key interface{}, desc, idDesc bool) clause.OrderBy {
+	sql := "?"
+	if desc {
+		sql += " DESC"
+	}
+	sql += ", ?"
+	if idDesc {
+		sql += " DESC"
 	}
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL:                sql,
+		Vars:               []interface{}{key, clause.Column{Name: "id"}},
+		WithoutParentheses: true,
+	}}
+}
+
+// likeEscaper escapes LIKE wildcards in user input. "!" is used as the escape
+// character because a backslash would need different quoting in each dialect.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func userFilterScope(filter models.UserFilter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter.Name != "" {
+			db = db.Where("LOWER(name) LIKE ? ESCAPE '!'", "%"+likeEscaper.Replace(strings.ToLower(filter.Name))+"%")
+		}
+		if filter.Q != "" {
+			text, key := searchText(filter.Q)
+			pattern := "%" + likeEscaper.Replace(text) + "%"
+			db = db.Where("(LOWER(name) LIKE ? ESCAPE '!' OR LOWER(email) LIKE ? ESCAPE '!' OR phone LIKE ? ESCAPE '!'"+
+				" OR name_pinyin LIKE ? ESCAPE '!' OR name_initials LIKE ? ESCAPE '!')",
+				pattern, pattern, pattern, "%"+likeEscaper.Replace(key)+"%", likeEscaper.Replace(key)+"%")
+		}
+		if filter.Status != nil {
+			db = db.Where("status = ?", *filter.Status)
+		}
+		if filter.MinAge != nil {
+			db = db.Where("age >= ?", *filter.MinAge)
+		}
+		if filter.MaxAge != nil {
+			db = db.Where("age <= ?", *filter.MaxAge)
+		}
+		if filter.CreatedFrom != nil {
+			db = db.Where("created_at >= ?", *filter.CreatedFrom)
+		}
+		if filter.CreatedTo != nil {
+			db = db.Where("created_at <= ?", *filter.CreatedTo)
+		}
+		if filter.EmailDomain != "" {
+			db = db.Where("LOWER(email) LIKE ? ESCAPE '!'", "%@"+likeEscaper.Replace(strings.ToLower(filter.EmailDomain)))
+		}
+		if filter.PhonePrefix != "" {
+			db = db.Where("phone LIKE ? ESCAPE '!'", likeEscaper.Replace(filter.PhonePrefix)+"%")
+		}
+		return db
+	}
+}
+
+func (r *userRepository) FindDeleted(ctx context.Context, page, size int) ([]models.User, int64, error) {
+	var users []models.User
+	var total int64
 
+	query := dbFor(ctx, r.db).Unscoped().Model(&models.User{}).Where("deleted_at IS NOT NULL")
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
-	order := clause.OrderByColumn{Column: clause.Column{Name: sortBy}, Desc: sortDesc}
 	offset := (page - 1) * size
-	err := query.Order(order).Limit(size).Offset(offset).Find(&users).Error
+	err := query.Preload("Roles").Order("deleted_at DESC").Limit(size).Offset(offset).Find(&users).Error
 	if err != nil {
 		return nil, 0, err
 	}
 
 	return users, total, nil
 }
+
+func (r *userRepository) FindDeletedByID(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	err := dbFor(ctx, r.db).Unscoped().Where("deleted_at IS NOT NULL").First(&user, id).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) Restore(ctx context.Context, id uint) error {
+	result := dbFor(ctx, r.db).Unscoped().Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{
+			"deleted_at":  nil,
+			"deleted_key": 0,
+			"version":     gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// PurgeDeletedBefore permanently removes users soft-deleted before cutoff,
+// together with their role assignments.
+func (r *userRepository) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) ([]models.User, error) {
+	var users []models.User
+	err := dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Preload("Roles").Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Find(&users).Error
+		if err != nil || len(users) == 0 {
+			return err
+		}
+
+		return tx.Unscoped().Select("Roles").Delete(&users).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
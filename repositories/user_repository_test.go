@@ -0,0 +1,62 @@
+package repositories_test
+
+import (
+	"hello/migrations"
+	"hello/repositories"
+	"hello/repositories/repotest"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMemoryUserRepository(t *testing.T) {
+	repotest.TestUserRepository(t, func(t *testing.T) repositories.UserRepository {
+		return repositories.NewMemoryUserRepository()
+	})
+}
+
+func TestGormUserRepository(t *testing.T) {
+	repotest.TestUserRepository(t, func(t *testing.T) repositories.UserRepository {
+		return repositories.NewUserRepository(openTestDB(t))
+	})
+}
+
+func TestMemoryTransactor(t *testing.T) {
+	repotest.TestTransactor(t, func(t *testing.T) (repositories.UserRepository, repositories.Transactor) {
+		repo := repositories.NewMemoryUserRepository()
+		return repo, repositories.NewMemoryTransactor(repo)
+	})
+}
+
+func TestGormTransactor(t *testing.T) {
+	repotest.TestTransactor(t, func(t *testing.T) (repositories.UserRepository, repositories.Transactor) {
+		db := openTestDB(t)
+		return repositories.NewUserRepository(db), repositories.NewTransactor(db)
+	})
+}
+
+// openTestDB returns a migrated SQLite database that is removed after the
+// test.
+func openTestDB(t *testing.T) *gorm.DB {
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if _, err := migrations.NewMigrator(db).Up(0); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
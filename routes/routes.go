@@ -4,14 +4,31 @@ import (
 	"hello/auth"
 	"hello/controllers"
 	"hello/middleware"
+	"hello/models"
+	"hello/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(r *gin.Engine, userController *controllers.UserController, authController *controllers.AuthController, jwtManager *auth.JWTManager) {
+// ExportUsersPath is the route of the user export, which is not bound by the
+// request timeout.
+const ExportUsersPath = "/api/users/export"
+
+func SetupRoutes(r *gin.Engine, userController *controllers.UserController, authController *controllers.AuthController, roleController *controllers.RoleController, auditController *controllers.AuditController, batchController *controllers.BatchController, jwtManager *auth.JWTManager, revocations auth.RevocationStore, roleService services.RoleService, restrictUnverified bool) {
+	authRequired := middleware.AuthMiddleware(jwtManager, revocations)
+	can := func(permission string) gin.HandlerFunc {
+		return middleware.RequirePermission(roleService, permission)
+	}
+	verifiedEmail := func(c *gin.Context) { c.Next() }
+	if restrictUnverified {
+		verifiedEmail = middleware.RequireVerifiedEmail()
+	}
+
 	// HTML routes
 	r.GET("/", userController.IndexPage)
 	r.GET("/login", authController.LoginPage)
+	r.GET("/reset-password", authController.ResetPasswordPage)
+	r.GET("/verify-email", authController.VerifyEmailPage)
 	r.GET("/users/new", userController.CreatePage)
 	r.GET("/users/:id/edit", userController.EditPage)
 	r.GET("/users/:id", userController.DetailPage)
@@ -22,26 +39,62 @@ func SetupRoutes(r *gin.Engine, userController *controllers.UserController, auth
 		// Auth routes (public)
 		api.POST("/auth/register", authController.Register)
 		api.POST("/auth/login", authController.Login)
-		api.POST("/auth/logout", authController.Logout)
+		api.POST("/auth/refresh", authController.Refresh)
+		api.POST("/auth/mfa/verify", authController.VerifyMFA)
+		api.POST("/auth/forgot-password", authController.ForgotPassword)
+		api.POST("/auth/reset-password", authController.ResetPassword)
+		api.GET("/auth/verify-email", authController.VerifyEmail)
+		api.POST("/auth/resend-verification", authController.ResendVerification)
+		api.GET("/auth/password-policy", authController.GetPasswordPolicy)
+
+		// Session routes, available before the email is verified
+		session := api.Group("")
+		session.Use(authRequired)
+		{
+			session.POST("/auth/logout", authController.Logout)
+			session.POST("/auth/logout-all", authController.LogoutAll)
+			session.GET("/auth/me", authController.GetCurrentUser)
+			session.GET("/users/me", authController.GetCurrentUser)
+		}
 
 		// Protected routes
 		protected := api.Group("")
-		protected.Use(middleware.AuthMiddleware(jwtManager))
+		protected.Use(authRequired, verifiedEmail)
 		{
-			protected.GET("/auth/me", authController.GetCurrentUser)
 			protected.POST("/auth/change-password", authController.ChangePassword)
-			protected.GET("/users/me", authController.GetCurrentUser)
-			protected.GET("/users", userController.GetAllUsers)
-			protected.GET("/users/search", userController.SearchUsers)
-			protected.POST("/users", userController.CreateUser)
-			protected.GET("/users/:id", userController.GetUserByID)
+			protected.GET("/auth/mfa", authController.GetMFAStatus)
+			protected.POST("/auth/mfa/enroll", authController.EnrollMFA)
+			protected.POST("/auth/mfa/confirm", authController.ConfirmMFA)
+			protected.GET("/users", can(models.PermissionUsersRead), userController.GetAllUsers)
+			protected.GET("/users/search", can(models.PermissionUsersRead), userController.SearchUsers)
+			protected.GET("/users/export", can(models.PermissionUsersRead), userController.ExportUsers)
+			protected.GET("/users/deleted", can(models.PermissionUsersDelete), userController.ListDeletedUsers)
+			protected.POST("/users", can(models.PermissionUsersCreate), userController.CreateUser)
+			protected.POST("/users/import", can(models.PermissionUsersCreate), userController.ImportUsers)
+			// Each item of a batch is authorized like its single-user endpoint
+			protected.POST("/users/batch", batchController.ApplyBatch)
+			protected.GET("/users/:id", can(models.PermissionUsersRead), userController.GetUserByID)
+			// Update and delete are authorized by the user service policy
 			protected.PUT("/users/:id", userController.UpdateUser)
+			protected.PATCH("/users/:id", userController.PatchUser)
 			protected.DELETE("/users/:id", userController.DeleteUser)
+			protected.POST("/users/:id/restore", userController.RestoreUser)
+			protected.DELETE("/users/:id/mfa", can(models.PermissionUsersUpdate), authController.ResetMFA)
+			protected.POST("/users/:id/unlock", can(models.PermissionUsersUpdate), authController.UnlockUser)
+
+			// Role administration
+			protected.GET("/roles", can(models.PermissionRolesManage), roleController.ListRoles)
+			protected.GET("/users/:id/roles", can(models.PermissionRolesManage), roleController.GetUserRoles)
+			protected.POST("/users/:id/roles", can(models.PermissionRolesManage), roleController.AssignRole)
+			protected.DELETE("/users/:id/roles/:role", can(models.PermissionRolesManage), roleController.RemoveRole)
+
+			// Audit trail
+			protected.GET("/audit", can(models.PermissionAuditRead), auditController.SearchAuditLogs)
 		}
 	}
 
 	// Form submission routes (for non-AJAX submissions)
-	r.POST("/users", userController.CreateUser)
-	r.PUT("/users/:id", userController.UpdateUser)
-	r.DELETE("/users/:id", userController.DeleteUser)
+	r.POST("/users", authRequired, verifiedEmail, can(models.PermissionUsersCreate), userController.CreateUser)
+	r.PUT("/users/:id", authRequired, verifiedEmail, userController.UpdateUser)
+	r.DELETE("/users/:id", authRequired, verifiedEmail, userController.DeleteUser)
 }
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"hello/models"
+	"hello/repositories"
+	"log"
+	"reflect"
+)
+
+type AuditService interface {
+	Record(ctx context.Context, actor Actor, action string, targetID uint, before, after *models.User)
+	Search(ctx context.Context, filter models.AuditLogFilter, page, size int) ([]models.AuditLog, int64, error)
+}
+
+type auditService struct {
+	repo repositories.AuditLogRepository
+}
+
+func NewAuditService(repo repositories.AuditLogRepository) AuditService {
+	return &auditService{repo: repo}
+}
+
+// Record appends an audit entry describing how the target user changed.
+// Failures are logged rather than returned because the mutation being
+// audited has already been committed. For the same reason the entry is
+// written even if ctx has been cancelled in the meantime.
+func (s *auditService) Record(ctx context.Context, actor Actor, action string, targetID uint, before, after *models.User) {
+	changes, err := json.Marshal(diffUsers(before, after))
+	if err != nil {
+		log.Printf("Failed to encode audit changes for %s on user %d: %v", action, targetID, err)
+		return
+	}
+
+	entry := &models.AuditLog{
+		ActorID:   actor.UserID,
+		Action:    action,
+		TargetID:  targetID,
+		Changes:   changes,
+		IP:        actor.IP,
+		UserAgent: truncate(actor.UserAgent, 255),
+	}
+	if err := s.repo.Create(context.WithoutCancel(ctx), entry); err != nil {
+		log.Printf("Failed to write audit log for %s on user %d: %v", action, targetID, err)
+	}
+}
+
+func (s *auditService) Search(ctx context.Context, filter models.AuditLogFilter, page, size int) ([]models.AuditLog, int64, error) {
+	page, size = normalizePage(page, size)
+	return s.repo.Search(ctx, filter, page, size)
+}
+
+// auditedFields lists the user attributes captured in the audit trail. The
+// password hash is deliberately never included.
+func auditedFields(user *models.User) map[string]interface{} {
+	if user == nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"name":           user.Name,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified(),
+		"phone":          user.Phone,
+		"age":            user.Age,
+		"status":         user.Status,
+		"roles":          user.RoleNames(),
+	}
+}
+
+func diffUsers(before, after *models.User) map[string]models.FieldChange {
+	oldFields := auditedFields(before)
+	newFields := auditedFields(after)
+
+	changes := make(map[string]models.FieldChange)
+	for _, field := range []string{"name", "email", "email_verified", "phone", "age", "status", "roles"} {
+		oldValue, hasOld := oldFields[field]
+		newValue, hasNew := newFields[field]
+		if hasOld && hasNew && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		changes[field] = models.FieldChange{Before: oldValue, After: newValue}
+	}
+	return changes
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max]
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hello/models"
+	"hello/repositories"
+)
+
+// MaxBatchItems bounds the number of users one batch may touch, counted over
+// all of its operations.
+const MaxBatchItems = 500
+
+type BatchService interface {
+	Apply(ctx context.Context, actor Actor, req *models.BatchRequest) (*models.BatchResult, error)
+}
+
+type batchService struct {
+	users UserService
+	roles RoleService
+	tx    repositories.Transactor
+}
+
+// NewBatchService applies batches through the user and role services, so
+// every item gets the same authorization and auditing as the single-user
+// endpoints.
+func NewBatchService(users UserService, roles RoleService, tx repositories.Transactor) BatchService {
+	return &batchService{users: users, roles: roles, tx: tx}
+}
+
+// errBatchAborted rolls back an all-or-nothing batch after an item failed.
+// The failure itself is reported on the item.
+var errBatchAborted = errors.New("batch aborted")
+
+func (s *batchService) Apply(ctx context.Context, actor Actor, req *models.BatchRequest) (*models.BatchResult, error) {
+	var items []models.BatchItemResult
+	for _, op := range req.Operations {
+		switch {
+		case op.Op == models.BatchOpSetStatus && op.Status == nil:
+			return nil, NewError(ErrValidation, "status is required for set_status")
+		case op.Op == models.BatchOpAssignRole && op.Role == "":
+			return nil, NewError(ErrValidation, "role is required for assign_role")
+		}
+		for _, id := range op.IDs {
+			items = append(items, models.BatchItemResult{Op: op.Op, ID: id})
+		}
+	}
+	if len(items) > MaxBatchItems {
+		return nil, NewError(ErrValidation, fmt.Sprintf("batch affects %d users, at most %d are allowed", len(items), MaxBatchItems))
+	}
+
+	result := &models.BatchResult{BestEffort: req.BestEffort, Items: items}
+	if req.BestEffort {
+		s.applyItems(ctx, actor, req, items, false)
+	} else {
+		err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+			return s.applyItems(ctx, actor, req, items, true)
+		})
+		if err != nil && !errors.Is(err, errBatchAborted) {
+			return nil, err
+		}
+		if errors.Is(err, errBatchAborted) {
+			for i := range items {
+				if items[i].Status == models.BatchItemSucceeded {
+					items[i].Status = models.BatchItemRolledBack
+				}
+			}
+		}
+	}
+
+	for _, item := range items {
+		switch item.Status {
+		case models.BatchItemSucceeded:
+			result.Succeeded++
+		case models.BatchItemFailed:
+			result.Failed++
+		}
+	}
+	return result, nil
+}
+
+// applyItems runs the items in order, recording each outcome. With
+// stopOnError the first failure marks the remaining items skipped and
+// returns errBatchAborted.
+func (s *batchService) applyItems(ctx context.Context, actor Actor, req *models.BatchRequest, items []models.BatchItemResult, stopOnError bool) error {
+	i := 0
+	for _, op := range req.Operations {
+		for range op.IDs {
+			item := &items[i]
+			i++
+
+			if err := s.applyItem(ctx, actor, op, item.ID); err != nil {
+				item.Status = models.BatchItemFailed
+				item.Err = err
+				if stopOnError {
+					for j := i; j < len(items); j++ {
+						items[j].Status = models.BatchItemSkipped
+					}
+					return errBatchAborted
+				}
+				continue
+			}
+			item.Status = models.BatchItemSucceeded
+		}
+	}
+	return nil
+}
+
+func (s *batchService) applyItem(ctx context.Context, actor Actor, op models.BatchOperation, id uint) error {
+	switch op.Op {
+	case models.BatchOpSetStatus:
+		_, err := s.users.PatchUser(ctx, actor, id, 0, &models.PatchUserRequest{Status: op.Status})
+		return err
+	case models.BatchOpDelete:
+		return s.users.DeleteUser(ctx, actor, id, 0)
+	case models.BatchOpRestore:
+		_, err := s.users.RestoreUser(ctx, actor, id)
+		return err
+	case models.BatchOpAssignRole:
+		// The single-user endpoint checks this permission in its route
+		allowed, err := s.roles.HasPermission(ctx, actor.Roles, models.PermissionRolesManage)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return NewError(ErrForbidden, "only administrators can assign roles")
+		}
+		return s.roles.AssignRole(ctx, actor, id, op.Role)
+	default:
+		return NewError(ErrValidation, "unknown operation "+op.Op)
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"hello/models"
+	"hello/repositories"
+	"time"
+)
+
+var errInvalidCursor = NewError(ErrValidation, "invalid cursor")
+
+// cursor is the decoded form of the opaque pagination tokens. It records the
+// sort it was issued for so it cannot be replayed against another order.
+type cursor struct {
+	SortBy   string          `json:"s"`
+	SortDesc bool            `json:"d"`
+	Value    json.RawMessage `json:"v"`
+	ID       uint            `json:"id"`
+}
+
+// encodeCursor returns the token pointing at user in the listing ordered by
+// sortBy.
+func encodeCursor(user *models.User, sortBy string, sortDesc bool) string {
+	var value interface{}
+	switch sortBy {
+	case "id":
+		value = user.ID
+	case "name", repositories.SortRelevance:
+		value = user.Name
+	case "email":
+		value = user.Email
+	case "phone":
+		value = user.Phone
+	case "age":
+		value = user.Age
+	case "status":
+		value = user.Status
+	default:
+		value = user.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	raw, _ := json.Marshal(value)
+	data, _ := json.Marshal(cursor{SortBy: sortBy, SortDesc: sortDesc, Value: raw, ID: user.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns a user holding the position token points at. Only the
+// sort column and ID are set.
+func decodeCursor(token, sortBy string, sortDesc bool) (*models.User, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errInvalidCursor
+	}
+	if c.SortBy != sortBy || c.SortDesc != sortDesc {
+		return nil, NewError(ErrValidation, "cursor was issued for a different sort order")
+	}
+
+	anchor := &models.User{ID: c.ID}
+	switch sortBy {
+	case "id":
+		err = json.Unmarshal(c.Value, &anchor.ID)
+	case "name":
+		err = json.Unmarshal(c.Value, &anchor.Name)
+	case repositories.SortRelevance:
+		// The rank is recomputed from the name and its derived pinyin
+		if err = json.Unmarshal(c.Value, &anchor.Name); err == nil {
+			err = anchor.BeforeSave(nil)
+		}
+	case "email":
+		err = json.Unmarshal(c.Value, &anchor.Email)
+	case "phone":
+		err = json.Unmarshal(c.Value, &anchor.Phone)
+	case "age":
+		err = json.Unmarshal(c.Value, &anchor.Age)
+	case "status":
+		err = json.Unmarshal(c.Value, &anchor.Status)
+	default:
+		var createdAt string
+		if err = json.Unmarshal(c.Value, &createdAt); err == nil {
+			anchor.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+		}
+	}
+	if err != nil || anchor.ID != c.ID {
+		return nil, errInvalidCursor
+	}
+	return anchor, nil
+}
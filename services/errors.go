@@ -0,0 +1,76 @@
+package services
+
+import (
+	"errors"
+	"hello/repositories"
+	"hello/validation"
+	"strings"
+	"time"
+)
+
+// Error kinds returned by the services. Controllers map them to HTTP status
+// codes; match them with errors.Is.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrValidation   = errors.New("validation failed")
+	ErrForbidden    = errors.New("forbidden")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrRateLimited  = errors.New("too many requests")
+)
+
+// ErrEmailExists is returned when another active user already has the email.
+var ErrEmailExists = NewError(ErrConflict, "email already exists")
+
+// Error is a domain error whose message is safe to show to clients. Kind is
+// one of the sentinel errors above. RetryAfter, when set, is how long the
+// client should wait before trying again. Fields, when set, are the request
+// fields that failed validation, without messages so that they can be
+// localized for the client.
+type Error struct {
+	Kind       error
+	Message    string
+	RetryAfter time.Duration
+	Fields     []validation.FieldError
+}
+
+func NewError(kind error, message string) error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// NewFieldsError returns an ErrValidation error for fields, whose message
+// lists them in English.
+func NewFieldsError(fields []validation.FieldError) error {
+	localized := validation.Localize(fields, validation.LangEnglish)
+	messages := make([]string, len(localized))
+	for i, fe := range localized {
+		messages[i] = fe.Message
+	}
+	return &Error{Kind: ErrValidation, Message: strings.Join(messages, "; "), Fields: fields}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// MapNotFound reports a missing record as ErrNotFound with message and passes
+// any other error, such as a cancelled request, through unchanged.
+func MapNotFound(err error, message string) error {
+	if errors.Is(err, repositories.ErrNotFound) {
+		return NewError(ErrNotFound, message)
+	}
+	return err
+}
+
+// MapDuplicateEmail reports a unique constraint violation as ErrEmailExists
+// and passes any other error through unchanged.
+func MapDuplicateEmail(err error) error {
+	if errors.Is(err, repositories.ErrDuplicate) {
+		return ErrEmailExists
+	}
+	return err
+}
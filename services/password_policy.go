@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"hello/models"
+	"hello/repositories"
+	"hello/utils"
+	"hello/validation"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Character classes a password policy can require.
+const (
+	PasswordClassLower  = "lower"
+	PasswordClassUpper  = "upper"
+	PasswordClassDigit  = "digit"
+	PasswordClassSymbol = "symbol"
+)
+
+// passwordClassCodes are the validation codes of missing character classes.
+var passwordClassCodes = map[string]string{
+	PasswordClassLower:  "password_lower",
+	PasswordClassUpper:  "password_upper",
+	PasswordClassDigit:  "password_digit",
+	PasswordClassSymbol: "password_symbol",
+}
+
+// MaxPasswordBytes is the longest password bcrypt can hash.
+const MaxPasswordBytes = 72
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = parseCommonPasswords(commonPasswordList)
+
+func parseCommonPasswords(list string) map[string]bool {
+	passwords := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			passwords[line] = true
+		}
+	}
+	return passwords
+}
+
+type PasswordPolicyConfig struct {
+	MinLength       int      // in characters
+	RequiredClasses []string // PasswordClass* values
+	History         int      // the last N passwords cannot be reused; 0 disables
+	MaxAge          time.Duration
+}
+
+// PasswordPolicy decides which passwords users may choose. Every password
+// must be long enough, contain the required character classes, not contain
+// the user's name or email and not be a commonly used password. When
+// changing a password, it also must not be one of the user's recent ones.
+type PasswordPolicy struct {
+	cfg     PasswordPolicyConfig
+	history repositories.PasswordHistoryRepository
+}
+
+func NewPasswordPolicy(cfg PasswordPolicyConfig, history repositories.PasswordHistoryRepository) (*PasswordPolicy, error) {
+	for _, class := range cfg.RequiredClasses {
+		if _, ok := passwordClassCodes[class]; !ok {
+			return nil, fmt.Errorf("unknown password character class %q", class)
+		}
+	}
+	return &PasswordPolicy{cfg: cfg, history: history}, nil
+}
+
+func (p *PasswordPolicy) Config() PasswordPolicyConfig {
+	return p.cfg
+}
+
+// Violations returns an error without message for each rule password breaks
+// for a user with the given name and email, not counting password history.
+// Field is the request field the password was sent in.
+func (p *PasswordPolicy) Violations(field, password, name, email string) []validation.FieldError {
+	var violations []validation.FieldError
+	violation := func(code, param string) {
+		violations = append(violations, validation.FieldError{Field: field, Code: code, Param: param})
+	}
+
+	if utf8.RuneCountInString(password) < p.cfg.MinLength {
+		violation("password_length", strconv.Itoa(p.cfg.MinLength))
+	}
+	if len(password) > MaxPasswordBytes {
+		violation("password_max_bytes", strconv.Itoa(MaxPasswordBytes))
+	}
+	for _, class := range p.missingClasses(password) {
+		violation(passwordClassCodes[class], "")
+	}
+	if containsPersonalInfo(password, name, email) {
+		violation("password_personal", "")
+	}
+	if isCommonPassword(password) {
+		violation("password_common", "")
+	}
+	return violations
+}
+
+// Check returns an ErrValidation error listing every rule password, sent in
+// the given request field, breaks. For an existing user it also rejects the
+// current and recent passwords.
+func (p *PasswordPolicy) Check(ctx context.Context, user *models.User, field, password string) error {
+	violations := p.Violations(field, password, user.Name, user.Email)
+	if len(violations) == 0 && user.ID != 0 && p.cfg.History > 0 {
+		reused, err := p.reused(ctx, user, password)
+		if err != nil {
+			return err
+		}
+		if reused {
+			violations = append(violations, validation.FieldError{Field: field, Code: "password_reused", Param: strconv.Itoa(p.cfg.History)})
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return NewFieldsError(violations)
+}
+
+func (p *PasswordPolicy) reused(ctx context.Context, user *models.User, password string) (bool, error) {
+	hashes := []string{user.Password}
+	if p.cfg.History > 1 {
+		previous, err := p.history.Recent(ctx, user.ID, p.cfg.History-1)
+		if err != nil {
+			return false, err
+		}
+		hashes = append(hashes, previous...)
+	}
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Remember records the hash of the password a user just replaced, once the
+// new one has been saved.
+func (p *PasswordPolicy) Remember(ctx context.Context, userID uint, oldHash string) error {
+	if p.cfg.History <= 1 {
+		return nil
+	}
+	return p.history.Add(ctx, userID, oldHash, p.cfg.History-1)
+}
+
+// Expired reports whether the user's password is older than the maximum
+// password age.
+func (p *PasswordPolicy) Expired(user *models.User) bool {
+	if p.cfg.MaxAge <= 0 {
+		return false
+	}
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	return time.Since(changedAt) > p.cfg.MaxAge
+}
+
+func (p *PasswordPolicy) missingClasses(password string) []string {
+	has := make(map[string]bool)
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			has[PasswordClassLower] = true
+		case unicode.IsUpper(r):
+			has[PasswordClassUpper] = true
+		case unicode.IsDigit(r):
+			has[PasswordClassDigit] = true
+		case unicode.IsPunct(r), unicode.IsSymbol(r), unicode.IsSpace(r):
+			has[PasswordClassSymbol] = true
+		}
+	}
+
+	var missing []string
+	for _, class := range p.cfg.RequiredClasses {
+		if !has[class] {
+			missing = append(missing, class)
+		}
+	}
+	return missing
+}
+
+// containsPersonalInfo reports whether password contains the user's name,
+// its pinyin, or the email or its local part. Fragments shorter than three
+// characters are ignored, since they would rule out too many passwords.
+func containsPersonalInfo(password, name, email string) bool {
+	fragments := strings.Fields(name)
+	fragments = append(fragments, strings.Join(fragments, ""))
+	pinyin, _ := utils.NamePinyin(name)
+	fragments = append(fragments, pinyin)
+
+	local, _, _ := strings.Cut(email, "@")
+	fragments = append(fragments, email, local)
+	fragments = append(fragments, strings.FieldsFunc(local, func(r rune) bool {
+		return r == '.' || r == '_' || r == '-' || r == '+'
+	})...)
+
+	lower := strings.ToLower(password)
+	for _, fragment := range fragments {
+		fragment = strings.ToLower(fragment)
+		if utf8.RuneCountInString(fragment) >= 3 && strings.Contains(lower, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCommonPassword also catches common passwords with digits or symbols
+// appended, such as "Password123!".
+func isCommonPassword(password string) bool {
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return true
+	}
+	base := strings.TrimRightFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return base != "" && commonPasswords[base]
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hello/models"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ctx = context.Background()
+
+// memoryPasswordHistory keeps the replaced password hashes of each user,
+// newest first.
+type memoryPasswordHistory struct {
+	hashes map[uint][]string
+}
+
+func newMemoryPasswordHistory() *memoryPasswordHistory {
+	return &memoryPasswordHistory{hashes: make(map[uint][]string)}
+}
+
+func (h *memoryPasswordHistory) Recent(ctx context.Context, userID uint, limit int) ([]string, error) {
+	hashes := h.hashes[userID]
+	return hashes[:min(limit, len(hashes))], nil
+}
+
+func (h *memoryPasswordHistory) Add(ctx context.Context, userID uint, hash string, keep int) error {
+	hashes := append([]string{hash}, h.hashes[userID]...)
+	h.hashes[userID] = hashes[:min(keep, len(hashes))]
+	return nil
+}
+
+func newTestPasswordPolicy(t *testing.T, cfg PasswordPolicyConfig) *PasswordPolicy {
+	policy, err := NewPasswordPolicy(cfg, newMemoryPasswordHistory())
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+	return policy
+}
+
+func hashPassword(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	return string(hash)
+}
+
+// violationCodes returns the codes of the field errors in err.
+func violationCodes(t *testing.T, err error) []string {
+	if err == nil {
+		return nil
+	}
+	var domainErr *Error
+	if !errors.As(err, &domainErr) || !errors.Is(err, ErrValidation) {
+		t.Fatalf("err = %v, want an ErrValidation *Error", err)
+	}
+	codes := make([]string, len(domainErr.Fields))
+	for i, fe := range domainErr.Fields {
+		codes[i] = fe.Code
+	}
+	return codes
+}
+
+func TestPasswordPolicyRules(t *testing.T) {
+	policy := newTestPasswordPolicy(t, PasswordPolicyConfig{
+		MinLength:       10,
+		RequiredClasses: []string{PasswordClassLower, PasswordClassUpper, PasswordClassDigit, PasswordClassSymbol},
+	})
+	user := &models.User{Name: "张三", Email: "zhang.wei@example.com"}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"valid", "Tr0ub4dor&3x", nil},
+		{"too short", "Tr0ub4&x", []string{"password_length"}},
+		{"length counts characters, not bytes", "密码Tr0ub4&xy", nil},
+		{"too long for bcrypt", "Tr0ub4dor&3" + strings.Repeat("x", 62), []string{"password_max_bytes"}},
+		{"missing lowercase", "TR0UB4DOR&3X", []string{"password_lower"}},
+		{"missing uppercase", "tr0ub4dor&3x", []string{"password_upper"}},
+		{"missing digit", "Troubador&xx", []string{"password_digit"}},
+		{"missing symbol", "Tr0ub4dor3xx", []string{"password_symbol"}},
+		{"missing several classes", "troubadorxx", []string{"password_upper", "password_digit", "password_symbol"}},
+		{"contains name pinyin", "Zhangsan&123", []string{"password_personal"}},
+		{"contains email local part", "Zhang.Wei&123", []string{"password_personal"}},
+		{"contains email fragment", "xWEI&123Abcd", []string{"password_personal"}},
+		{"common", "Password12!x", nil},
+		{"common with suffix", "Password123!", []string{"password_common"}},
+		{"common and short", "dragon", []string{"password_length", "password_upper", "password_digit", "password_symbol", "password_common"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violationCodes(t, policy.Check(ctx, user, "password", tt.password))
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyReportsField(t *testing.T) {
+	policy := newTestPasswordPolicy(t, PasswordPolicyConfig{MinLength: 8})
+
+	var domainErr *Error
+	if err := policy.Check(ctx, &models.User{}, "new_password", "short"); !errors.As(err, &domainErr) {
+		t.Fatalf("err = %v, want *Error", err)
+	}
+	fe := domainErr.Fields[0]
+	if fe.Field != "new_password" || fe.Param != "8" || fe.Message != "" {
+		t.Fatalf("field error = %+v, want new_password with param 8 and no message", fe)
+	}
+	if domainErr.Message != "new_password must be at least 8 characters" {
+		t.Fatalf("message = %q", domainErr.Message)
+	}
+}
+
+func TestNewPasswordPolicyRejectsUnknownClass(t *testing.T) {
+	if _, err := NewPasswordPolicy(PasswordPolicyConfig{RequiredClasses: []string{"emoji"}}, nil); err == nil {
+		t.Fatal("unknown class accepted")
+	}
+}
+
+func TestPasswordPolicyHistory(t *testing.T) {
+	passwords := []string{"Oldest#pass1", "Older#pass2", "Recent#pass3", "Current#pass4"}
+
+	tests := []struct {
+		name     string
+		history  int
+		password string
+		want     []string
+	}{
+		{"current password", 3, "Current#pass4", []string{"password_reused"}},
+		{"recent password", 3, "Recent#pass3", []string{"password_reused"}},
+		{"last remembered password", 3, "Older#pass2", []string{"password_reused"}},
+		{"forgotten password", 3, "Oldest#pass1", nil},
+		{"new password", 3, "Brand#new5", nil},
+		{"only the current password", 1, "Recent#pass3", nil},
+		{"current password with history of one", 1, "Current#pass4", []string{"password_reused"}},
+		{"history disabled", 0, "Current#pass4", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := newTestPasswordPolicy(t, PasswordPolicyConfig{MinLength: 8, History: tt.history})
+
+			// Change through every password, remembering each replaced one
+			user := &models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Password: hashPassword(t, passwords[0])}
+			for _, next := range passwords[1:] {
+				old := user.Password
+				user.Password = hashPassword(t, next)
+				if err := policy.Remember(ctx, user.ID, old); err != nil {
+					t.Fatalf("remember: %v", err)
+				}
+			}
+
+			got := violationCodes(t, policy.Check(ctx, user, "new_password", tt.password))
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyHistoryIgnoresNewUsers(t *testing.T) {
+	policy := newTestPasswordPolicy(t, PasswordPolicyConfig{MinLength: 8, History: 3})
+	// A user being created has no ID and no password to compare with
+	if err := policy.Check(ctx, &models.User{Name: "Alice", Email: "alice@example.com"}, "password", "Brand#new5"); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+}
+
+func TestPasswordPolicyExpired(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name      string
+		maxAge    time.Duration
+		createdAt time.Time
+		changedAt *time.Time
+		want      bool
+	}{
+		{"expiry disabled", 0, now.Add(-1000 * day), nil, false},
+		{"changed recently", 90 * day, now.Add(-1000 * day), ago(10 * day), false},
+		{"changed too long ago", 90 * day, now.Add(-1000 * day), ago(91 * day), true},
+		{"never changed, created recently", 90 * day, now.Add(-10 * day), nil, false},
+		{"never changed, created too long ago", 90 * day, now.Add(-91 * day), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := newTestPasswordPolicy(t, PasswordPolicyConfig{MaxAge: tt.maxAge})
+			user := &models.User{CreatedAt: tt.createdAt, PasswordChangedAt: tt.changedAt}
+			if got := policy.Expired(user); got != tt.want {
+				t.Fatalf("expired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
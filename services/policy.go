@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"hello/models"
+	"hello/repositories"
+)
+
+// Actor identifies the caller of a service method. A zero UserID means an
+// anonymous or system caller.
+type Actor struct {
+	UserID    uint
+	Roles     []string
+	IP        string
+	UserAgent string
+}
+
+func hasPermission(ctx context.Context, roleRepo repositories.RoleRepository, roleNames []string, permission string) (bool, error) {
+	roles, err := roleRepo.FindByNames(ctx, roleNames)
+	if err != nil {
+		return false, err
+	}
+
+	for _, role := range roles {
+		for _, perm := range role.Permissions {
+			if perm.Name == permission {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// authorizeUpdate lets privileged actors edit any field of any user, while
+// everyone else may only change the name, phone and age of their own profile.
+func authorizeUpdate(ctx context.Context, roleRepo repositories.RoleRepository, actor Actor, user *models.User, req *models.PatchUserRequest) error {
+	privileged, err := hasPermission(ctx, roleRepo, actor.Roles, models.PermissionUsersUpdate)
+	if err != nil {
+		return err
+	}
+	if privileged {
+		return nil
+	}
+
+	if actor.UserID != user.ID {
+		return NewError(ErrForbidden, "you can only update your own profile")
+	}
+	if req.Email != nil && *req.Email != user.Email {
+		return NewError(ErrForbidden, "only administrators can change email")
+	}
+	if req.Status != nil && *req.Status != user.Status {
+		return NewError(ErrForbidden, "only administrators can change status")
+	}
+	return nil
+}
+
+func authorizeDelete(ctx context.Context, roleRepo repositories.RoleRepository, actor Actor) error {
+	privileged, err := hasPermission(ctx, roleRepo, actor.Roles, models.PermissionUsersDelete)
+	if err != nil {
+		return err
+	}
+	if !privileged {
+		return NewError(ErrForbidden, "only administrators can delete users")
+	}
+	return nil
+}
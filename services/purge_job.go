@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// StartPurgeJob runs PurgeDeletedUsers once immediately and then on every
+// interval until the returned stop function is called. Stopping also cancels
+// a purge that is still running.
+func StartPurgeJob(service UserService, retention, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	run := func() {
+		purged, err := service.PurgeDeletedUsers(ctx, retention)
+		if err != nil {
+			log.Printf("Failed to purge deleted users: %v", err)
+			return
+		}
+		if purged > 0 {
+			log.Printf("Purged %d deleted users", purged)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		run()
+		for {
+			select {
+			case <-ticker.C:
+				run()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return cancel
+}
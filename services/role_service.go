@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"hello/models"
+	"hello/repositories"
+)
+
+type RoleService interface {
+	EnsureDefaultRoles(ctx context.Context) error
+	ListRoles(ctx context.Context) ([]models.Role, error)
+	GetUserRoles(ctx context.Context, userID uint) ([]models.Role, error)
+	AssignRole(ctx context.Context, actor Actor, userID uint, roleName string) error
+	RemoveRole(ctx context.Context, actor Actor, userID uint, roleName string) error
+	HasPermission(ctx context.Context, roleNames []string, permission string) (bool, error)
+}
+
+type roleService struct {
+	roleRepo repositories.RoleRepository
+	userRepo repositories.UserRepository
+	audit    AuditService
+}
+
+func NewRoleService(roleRepo repositories.RoleRepository, userRepo repositories.UserRepository, audit AuditService) RoleService {
+	return &roleService{roleRepo: roleRepo, userRepo: userRepo, audit: audit}
+}
+
+// EnsureDefaultRoles seeds the built-in admin and user roles. It is safe to
+// call on every startup.
+func (s *roleService) EnsureDefaultRoles(ctx context.Context) error {
+	err := s.roleRepo.EnsureRole(ctx, models.RoleAdmin, "系统管理员", []string{
+		models.PermissionUsersRead,
+		models.PermissionUsersCreate,
+		models.PermissionUsersUpdate,
+		models.PermissionUsersDelete,
+		models.PermissionRolesManage,
+		models.PermissionAuditRead,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.roleRepo.EnsureRole(ctx, models.RoleUser, "普通用户", []string{
+		models.PermissionUsersRead,
+	})
+}
+
+func (s *roleService) ListRoles(ctx context.Context) ([]models.Role, error) {
+	return s.roleRepo.FindAll(ctx)
+}
+
+func (s *roleService) GetUserRoles(ctx context.Context, userID uint) ([]models.Role, error) {
+	if _, err := s.userRepo.FindByID(ctx, userID); err != nil {
+		return nil, MapNotFound(err, "user not found")
+	}
+	return s.roleRepo.FindByUserID(ctx, userID)
+}
+
+func (s *roleService) AssignRole(ctx context.Context, actor Actor, userID uint, roleName string) error {
+	before, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return MapNotFound(err, "user not found")
+	}
+
+	role, err := s.roleRepo.FindByName(ctx, roleName)
+	if err != nil {
+		return MapNotFound(err, "role not found")
+	}
+
+	if err := s.roleRepo.AddUserRole(ctx, userID, role); err != nil {
+		return err
+	}
+
+	s.recordRoleChange(ctx, actor, models.AuditActionRoleAssign, before)
+	return nil
+}
+
+func (s *roleService) RemoveRole(ctx context.Context, actor Actor, userID uint, roleName string) error {
+	before, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return MapNotFound(err, "user not found")
+	}
+
+	role, err := s.roleRepo.FindByName(ctx, roleName)
+	if err != nil {
+		return MapNotFound(err, "role not found")
+	}
+
+	if err := s.roleRepo.RemoveUserRole(ctx, userID, role); err != nil {
+		return err
+	}
+
+	s.recordRoleChange(ctx, actor, models.AuditActionRoleRemove, before)
+	return nil
+}
+
+func (s *roleService) recordRoleChange(ctx context.Context, actor Actor, action string, before *models.User) {
+	after, err := s.userRepo.FindByID(context.WithoutCancel(ctx), before.ID)
+	if err != nil {
+		after = nil
+	}
+	s.audit.Record(ctx, actor, action, before.ID, before, after)
+}
+
+func (s *roleService) HasPermission(ctx context.Context, roleNames []string, permission string) (bool, error) {
+	return hasPermission(ctx, s.roleRepo, roleNames, permission)
+}
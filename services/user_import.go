@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"hello/models"
+	"hello/validation"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxImportRows bounds the size of one import. Every row costs a bcrypt hash,
+// and the whole import has to finish within the request timeout.
+const MaxImportRows = 500
+
+// ImportUsers checks every row for duplicate emails, within the file and
+// against active users, on top of the errors found by the caller. The errors
+// it adds have no message; the caller localizes them. Unless this
+// is a dry run, the users are then created in a single transaction, but only
+// if no row has an error.
+func (s *userService) ImportUsers(ctx context.Context, actor Actor, rows []models.ImportRow, dryRun bool) (*models.ImportReport, error) {
+	if len(rows) == 0 {
+		return nil, NewError(ErrValidation, "import file has no rows")
+	}
+	if len(rows) > MaxImportRows {
+		return nil, NewError(ErrValidation, fmt.Sprintf("import file has %d rows, at most %d are allowed", len(rows), MaxImportRows))
+	}
+
+	report := &models.ImportReport{DryRun: dryRun, Total: len(rows), Rows: make([]models.ImportRowResult, len(rows))}
+
+	firstLine := make(map[string]int)
+	var emails []string
+	for i, row := range rows {
+		result := models.ImportRowResult{Line: row.Line, Email: row.User.Email, Errors: row.Errors}
+		if row.User.Password != "" {
+			result.Errors = append(result.Errors, s.passwords.Violations("password", row.User.Password, row.User.Name, row.User.Email)...)
+		}
+		if email := row.User.Email; email != "" {
+			if line, seen := firstLine[email]; seen {
+				result.Errors = append(result.Errors, validation.FieldError{
+					Field: "email",
+					Code:  "duplicate",
+					Param: strconv.Itoa(line),
+				})
+			} else {
+				firstLine[email] = row.Line
+				emails = append(emails, email)
+			}
+		}
+		report.Rows[i] = result
+	}
+
+	existing, err := s.repo.FindExistingEmails(ctx, emails)
+	if err != nil {
+		return nil, err
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, email := range existing {
+		taken[email] = true
+	}
+
+	for i := range report.Rows {
+		result := &report.Rows[i]
+		if taken[result.Email] {
+			result.Errors = append(result.Errors, validation.FieldError{Field: "email", Code: "exists"})
+		}
+		if len(result.Errors) > 0 {
+			result.Status = models.ImportStatusInvalid
+			report.Invalid++
+		} else {
+			result.Status = models.ImportStatusValid
+			report.Valid++
+		}
+	}
+	if dryRun || report.Invalid > 0 {
+		return report, nil
+	}
+
+	passwords := make([]string, len(rows))
+	for i, row := range rows {
+		passwords[i] = row.User.Password
+	}
+	hashes, err := hashPasswords(ctx, passwords)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []models.Role
+	if role, err := s.roleRepo.FindByName(ctx, models.RoleUser); err == nil {
+		roles = []models.Role{*role}
+	}
+
+	now := time.Now()
+	users := make([]*models.User, len(rows))
+	for i, row := range rows {
+		users[i] = &models.User{
+			Name:              row.User.Name,
+			Email:             row.User.Email,
+			Password:          hashes[i],
+			Phone:             row.User.Phone,
+			Age:               row.User.Age,
+			Status:            row.User.StatusOrDefault(),
+			Roles:             roles,
+			PasswordChangedAt: &now,
+		}
+	}
+
+	// Another request may have taken an email since the check above
+	if err := s.repo.CreateBatch(ctx, users); err != nil {
+		return nil, MapDuplicateEmail(err)
+	}
+
+	for i, user := range users {
+		report.Rows[i].Status = models.ImportStatusCreated
+		report.Rows[i].ID = user.ID
+		s.audit.Record(ctx, actor, models.AuditActionUserCreate, user.ID, nil, user)
+	}
+	report.Created = len(users)
+	return report, nil
+}
+
+// hashPasswords hashes the passwords on all CPUs, since bcrypt dominates the
+// cost of a large import.
+func hashPasswords(ctx context.Context, passwords []string) ([]string, error) {
+	hashes := make([]string, len(passwords))
+	errs := make([]error, len(passwords))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+
+	var wg sync.WaitGroup
+	for i, password := range passwords {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := ctx.Err(); err != nil {
+				errs[i] = err
+				return
+			}
+			hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+			hashes[i], errs[i] = string(hash), err
+		})
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
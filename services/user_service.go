@@ -1,36 +1,59 @@
 package services
 
 import (
-	"errors"
+	"context"
 	"hello/models"
 	"hello/repositories"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UserService interface {
-	CreateUser(req *models.CreateUserRequest) (*models.User, error)
-	GetAllUsers() ([]models.User, error)
-	GetUserByID(id uint) (*models.User, error)
-	UpdateUser(id uint, req *models.UpdateUserRequest) (*models.User, error)
-	DeleteUser(id uint) error
-	SearchUsers(name string, page, size int, sortBy, sortOrder string) ([]models.User, int64, error)
+	CreateUser(ctx context.Context, actor Actor, req *models.CreateUserRequest) (*models.User, error)
+	ImportUsers(ctx context.Context, actor Actor, rows []models.ImportRow, dryRun bool) (*models.ImportReport, error)
+	GetUserByID(ctx context.Context, id uint) (*models.User, error)
+	UpdateUser(ctx context.Context, actor Actor, id, version uint, req *models.UpdateUserRequest) (*models.User, error)
+	PatchUser(ctx context.Context, actor Actor, id, version uint, req *models.PatchUserRequest) (*models.User, error)
+	DeleteUser(ctx context.Context, actor Actor, id, version uint) error
+	SearchUsers(ctx context.Context, filter models.UserFilter, req models.PageRequest) (*models.UserPage, error)
+	ExportUsers(ctx context.Context, filter models.UserFilter, sortBy, sortOrder string, fn func([]models.User) error) error
+	ListDeletedUsers(ctx context.Context, page, size int) ([]models.User, int64, error)
+	RestoreUser(ctx context.Context, actor Actor, id uint) (*models.User, error)
+	PurgeDeletedUsers(ctx context.Context, retention time.Duration) (int64, error)
 }
 
 type userService struct {
-	repo repositories.UserRepository
+	repo         repositories.UserRepository
+	roleRepo     repositories.RoleRepository
+	audit        AuditService
+	passwords    *PasswordPolicy
+	queryTimeout time.Duration // bounds each export batch query; 0 disables
 }
 
-func NewUserService(repo repositories.UserRepository) UserService {
-	return &userService{repo: repo}
+func NewUserService(repo repositories.UserRepository, roleRepo repositories.RoleRepository, audit AuditService, passwords *PasswordPolicy, queryTimeout time.Duration) UserService {
+	return &userService{repo: repo, roleRepo: roleRepo, audit: audit, passwords: passwords, queryTimeout: queryTimeout}
 }
 
-func (s *userService) CreateUser(req *models.CreateUserRequest) (*models.User, error) {
+func (s *userService) CreateUser(ctx context.Context, actor Actor, req *models.CreateUserRequest) (*models.User, error) {
 	// Check if email already exists
-	existingUser, err := s.repo.FindByEmail(req.Email)
+	existingUser, err := s.repo.FindByEmail(ctx, req.Email)
 	if err == nil && existingUser != nil {
-		return nil, errors.New("email already exists")
+		return nil, ErrEmailExists
+	}
+
+	now := time.Now()
+	user := &models.User{
+		Name:              req.Name,
+		Email:             req.Email,
+		Phone:             req.Phone,
+		Age:               req.Age,
+		Status:            req.StatusOrDefault(),
+		PasswordChangedAt: &now,
+	}
+	if err := s.passwords.Check(ctx, user, "password", req.Password); err != nil {
+		return nil, err
 	}
 
 	// Hash password
@@ -38,88 +61,279 @@ func (s *userService) CreateUser(req *models.CreateUserRequest) (*models.User, e
 	if err != nil {
 		return nil, err
 	}
+	user.Password = string(hashedPassword)
 
-	user := &models.User{
-		Name:     req.Name,
-		Email:    req.Email,
-		Password: string(hashedPassword),
-		Phone:    req.Phone,
-		Age:      req.Age,
-		Status:   req.Status,
-	}
-
-	if req.Status == 0 {
-		user.Status = 1 // Default to active
+	if role, err := s.roleRepo.FindByName(ctx, models.RoleUser); err == nil {
+		user.Roles = []models.Role{*role}
 	}
 
-	err = s.repo.Create(user)
+	err = s.repo.Create(ctx, user)
 	if err != nil {
-		return nil, err
+		return nil, MapDuplicateEmail(err)
 	}
 
+	s.audit.Record(ctx, actor, models.AuditActionUserCreate, user.ID, nil, user)
 	return user, nil
 }
 
-func (s *userService) GetAllUsers() ([]models.User, error) {
-	return s.repo.FindAll()
+func (s *userService) GetUserByID(ctx context.Context, id uint) (*models.User, error) {
+	user, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, MapNotFound(err, "user not found")
+	}
+	return user, nil
 }
 
-func (s *userService) GetUserByID(id uint) (*models.User, error) {
-	return s.repo.FindByID(id)
+// UpdateUser replaces every editable field of the user with the values in
+// req, including zero values.
+func (s *userService) UpdateUser(ctx context.Context, actor Actor, id, version uint, req *models.UpdateUserRequest) (*models.User, error) {
+	return s.PatchUser(ctx, actor, id, version, &models.PatchUserRequest{
+		Name:   &req.Name,
+		Email:  &req.Email,
+		Phone:  &req.Phone,
+		Age:    &req.Age,
+		Status: req.Status,
+	})
 }
 
-func (s *userService) UpdateUser(id uint, req *models.UpdateUserRequest) (*models.User, error) {
-	user, err := s.repo.FindByID(id)
+// PatchUser writes only the non-nil fields of req. A non-zero version must
+// match the user's current version.
+func (s *userService) PatchUser(ctx context.Context, actor Actor, id, version uint, req *models.PatchUserRequest) (*models.User, error) {
+	user, err := s.repo.FindByID(ctx, id)
 	if err != nil {
+		return nil, MapNotFound(err, "user not found")
+	}
+	if version != 0 && user.Version != version {
+		return nil, repositories.ErrVersionConflict
+	}
+
+	if err := authorizeUpdate(ctx, s.roleRepo, actor, user, req); err != nil {
 		return nil, err
 	}
+	before := *user
 
 	// Check if email is being changed and if it conflicts with another user
-	if req.Email != "" && req.Email != user.Email {
-		existingUser, err := s.repo.FindByEmail(req.Email)
+	if req.Email != nil && *req.Email != user.Email {
+		existingUser, err := s.repo.FindByEmail(ctx, *req.Email)
 		if err == nil && existingUser != nil && existingUser.ID != id {
-			return nil, errors.New("email already exists")
+			return nil, ErrEmailExists
 		}
-		user.Email = req.Email
+		user.Email = *req.Email
+		// The new address has not been verified
+		user.EmailVerifiedAt = nil
 	}
 
-	if req.Name != "" {
-		user.Name = req.Name
+	if req.Name != nil {
+		user.Name = *req.Name
 	}
-	if req.Phone != "" {
-		user.Phone = req.Phone
+	if req.Phone != nil {
+		user.Phone = *req.Phone
 	}
-	if req.Age != 0 {
-		user.Age = req.Age
+	if req.Age != nil {
+		user.Age = *req.Age
 	}
-	if req.Status != 0 {
-		user.Status = req.Status
+	if req.Status != nil {
+		user.Status = *req.Status
 	}
 
-	err = s.repo.Update(user)
+	err = s.repo.Update(ctx, user)
 	if err != nil {
-		return nil, err
+		return nil, MapDuplicateEmail(err)
 	}
 
+	s.audit.Record(ctx, actor, models.AuditActionUserUpdate, user.ID, &before, user)
 	return user, nil
 }
 
-func (s *userService) DeleteUser(id uint) error {
-	return s.repo.Delete(id)
+func (s *userService) DeleteUser(ctx context.Context, actor Actor, id, version uint) error {
+	if err := authorizeDelete(ctx, s.roleRepo, actor); err != nil {
+		return err
+	}
+
+	user, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return MapNotFound(err, "user not found")
+	}
+	if version != 0 && user.Version != version {
+		return repositories.ErrVersionConflict
+	}
+
+	// Deleting only the version just read keeps the audit record accurate
+	// when the user changes in the meantime
+	if err := s.repo.Delete(ctx, id, user.Version); err != nil {
+		return MapNotFound(err, "user not found")
+	}
+
+	s.audit.Record(ctx, actor, models.AuditActionUserDelete, id, user, nil)
+	return nil
 }
 
-func (s *userService) SearchUsers(name string, page, size int, sortBy, sortOrder string) ([]models.User, int64, error) {
-	name = strings.TrimSpace(name)
-	if page < 1 {
-		page = 1
+func (s *userService) ListDeletedUsers(ctx context.Context, page, size int) ([]models.User, int64, error) {
+	page, size = normalizePage(page, size)
+	return s.repo.FindDeleted(ctx, page, size)
+}
+
+func (s *userService) RestoreUser(ctx context.Context, actor Actor, id uint) (*models.User, error) {
+	if err := authorizeDelete(ctx, s.roleRepo, actor); err != nil {
+		return nil, err
 	}
-	if size < 1 {
-		size = 10
+
+	user, err := s.repo.FindDeletedByID(ctx, id)
+	if err != nil {
+		return nil, MapNotFound(err, "deleted user not found")
 	}
-	if size > 100 {
-		size = 100
+
+	// Another live user may have taken the address since the delete
+	existingUser, err := s.repo.FindByEmail(ctx, user.Email)
+	if err == nil && existingUser != nil {
+		return nil, ErrEmailExists
+	}
+
+	if err := s.repo.Restore(ctx, id); err != nil {
+		return nil, MapDuplicateEmail(MapNotFound(err, "deleted user not found"))
+	}
+
+	restored, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, actor, models.AuditActionUserRestore, id, nil, restored)
+	return restored, nil
+}
+
+// PurgeDeletedUsers permanently removes users that have been soft-deleted for
+// longer than the retention period.
+func (s *userService) PurgeDeletedUsers(ctx context.Context, retention time.Duration) (int64, error) {
+	users, err := s.repo.PurgeDeletedBefore(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range users {
+		s.audit.Record(ctx, Actor{}, models.AuditActionUserPurge, users[i].ID, &users[i], nil)
+	}
+	return int64(len(users)), nil
+}
+
+func (s *userService) SearchUsers(ctx context.Context, filter models.UserFilter, req models.PageRequest) (*models.UserPage, error) {
+	filter = normalizeFilter(filter)
+	page, size := normalizePage(req.Page, req.Size)
+	sortBy, sortDesc := normalizeSort(filter, req.SortBy, req.SortOrder)
+
+	if req.After != "" || req.Before != "" {
+		return s.searchByCursor(ctx, filter, req, size, sortBy, sortDesc)
 	}
 
+	users, total, err := s.repo.Search(ctx, filter, page, size, sortBy, sortDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.UserPage{Items: users, Page: page, Size: size, Total: &total}
+	if len(users) > 0 {
+		if page > 1 {
+			result.PrevCursor = encodeCursor(&users[0], sortBy, sortDesc)
+		}
+		if int64((page-1)*size+len(users)) < total {
+			result.NextCursor = encodeCursor(&users[len(users)-1], sortBy, sortDesc)
+		}
+	}
+	return result, nil
+}
+
+// searchByCursor reads one row past the page to learn whether the listing
+// continues in the direction of travel. The other direction is assumed to
+// continue, since the cursor came from a row there.
+func (s *userService) searchByCursor(ctx context.Context, filter models.UserFilter, req models.PageRequest, size int, sortBy string, sortDesc bool) (*models.UserPage, error) {
+	if req.After != "" && req.Before != "" {
+		return nil, NewError(ErrValidation, "after and before cannot be used together")
+	}
+
+	keyset := repositories.Keyset{SortBy: sortBy, SortDesc: sortDesc, Backward: req.Before != "", Limit: size + 1}
+	token := req.After
+	if keyset.Backward {
+		token = req.Before
+	}
+	anchor, err := decodeCursor(token, sortBy, sortDesc)
+	if err != nil {
+		return nil, err
+	}
+	keyset.Anchor = anchor
+
+	users, err := s.repo.SearchKeyset(ctx, filter, keyset)
+	if err != nil {
+		return nil, err
+	}
+
+	more := len(users) > size
+	if more && keyset.Backward {
+		users = users[1:]
+	} else if more {
+		users = users[:size]
+	}
+
+	result := &models.UserPage{Items: users, Size: size}
+	if len(users) > 0 {
+		if more || !keyset.Backward {
+			result.PrevCursor = encodeCursor(&users[0], sortBy, sortDesc)
+		}
+		if more || keyset.Backward {
+			result.NextCursor = encodeCursor(&users[len(users)-1], sortBy, sortDesc)
+		}
+	}
+	return result, nil
+}
+
+// exportBatchSize is how many users ExportUsers reads per query.
+const exportBatchSize = 500
+
+// ExportUsers passes every user matching filter to fn, in the order
+// SearchUsers would list them, a batch at a time so the result set is never
+// held in memory at once. It stops at the first error from fn. The whole
+// export may take longer than a request is normally allowed to; instead
+// each batch query is bounded by the query timeout.
+func (s *userService) ExportUsers(ctx context.Context, filter models.UserFilter, sortBy, sortOrder string, fn func([]models.User) error) error {
+	filter = normalizeFilter(filter)
+	sortBy, sortDesc := normalizeSort(filter, sortBy, sortOrder)
+
+	keyset := repositories.Keyset{SortBy: sortBy, SortDesc: sortDesc, Limit: exportBatchSize}
+	for {
+		users, err := s.exportBatch(ctx, filter, keyset)
+		if err != nil {
+			return err
+		}
+		if len(users) > 0 {
+			if err := fn(users); err != nil {
+				return err
+			}
+		}
+		if len(users) < exportBatchSize {
+			return nil
+		}
+		keyset.Anchor = &users[len(users)-1]
+	}
+}
+
+func (s *userService) exportBatch(ctx context.Context, filter models.UserFilter, keyset repositories.Keyset) ([]models.User, error) {
+	if s.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.queryTimeout)
+		defer cancel()
+	}
+	return s.repo.SearchKeyset(ctx, filter, keyset)
+}
+
+func normalizeFilter(filter models.UserFilter) models.UserFilter {
+	filter.Name = strings.TrimSpace(filter.Name)
+	filter.Q = strings.TrimSpace(filter.Q)
+	filter.EmailDomain = strings.TrimPrefix(strings.TrimSpace(filter.EmailDomain), "@")
+	filter.PhonePrefix = strings.TrimSpace(filter.PhonePrefix)
+	return filter
+}
+
+// normalizeSort falls back to newest first for unknown sort columns.
+func normalizeSort(filter models.UserFilter, sortBy, sortOrder string) (string, bool) {
 	sortBy = strings.ToLower(strings.TrimSpace(sortBy))
 	allowedSort := map[string]struct{}{
 		"id":         {},
@@ -129,16 +343,35 @@ func (s *userService) SearchUsers(name string, page, size int, sortBy, sortOrder
 		"age":        {},
 		"status":     {},
 		"created_at": {},
+
+		repositories.SortRelevance: {},
 	}
 	if _, ok := allowedSort[sortBy]; !ok {
 		sortBy = "created_at"
 	}
 
-	sortOrder = strings.ToLower(strings.TrimSpace(sortOrder))
-	sortDesc := true
-	if sortOrder == "asc" {
-		sortDesc = false
+	sortDesc := strings.ToLower(strings.TrimSpace(sortOrder)) != "asc"
+
+	// Relevance needs search text and always lists the best matches first
+	if sortBy == repositories.SortRelevance {
+		if filter.Q == "" {
+			sortBy = "created_at"
+		} else {
+			sortDesc = false
+		}
 	}
+	return sortBy, sortDesc
+}
 
-	return s.repo.SearchByName(name, page, size, sortBy, sortDesc)
+func normalizePage(page, size int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = 10
+	}
+	if size > 100 {
+		size = 100
+	}
+	return page, size
 }
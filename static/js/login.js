@@ -0,0 +1,44 @@
+// 登录页与首页登录框共用的登录流程: 密码登录、两步验证与保存会话
+
+// 使用邮箱和密码登录。开启两步验证的账号返回 data.mfa_required 与 data.mfa_token
+async function requestLogin(email, password) {
+    const response = await fetch('/api/auth/login', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'Accept-Language': 'zh-CN',
+        },
+        body: JSON.stringify({ email, password })
+    });
+    return { response, data: await response.json() };
+}
+
+// 用登录返回的 mfa_token 与验证码 (或恢复码) 换取 Token
+async function requestMFAVerify(mfaToken, code) {
+    const response = await fetch('/api/auth/mfa/verify', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'Accept-Language': 'zh-CN',
+        },
+        body: JSON.stringify({ mfa_token: mfaToken, code })
+    });
+    return { response, data: await response.json() };
+}
+
+function saveSession(data) {
+    localStorage.setItem('token', data.token);
+    localStorage.setItem('refreshToken', data.refresh_token);
+    localStorage.setItem('user', JSON.stringify(data.user));
+}
+
+// 登录失败时展示给用户的提示
+function loginErrorMessage(response, data) {
+    if (response.status === 403 && data.detail === 'password has expired') {
+        return '密码已过期，请使用“忘记密码”重置密码';
+    }
+    if (response.status === 429) {
+        return '登录失败次数过多，请在 ' + response.headers.get('Retry-After') + ' 秒后重试';
+    }
+    return '登录失败: ' + data.detail;
+}
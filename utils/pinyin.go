@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mozillazg/go-pinyin"
+)
+
+var pinyinArgs = pinyin.NewArgs()
+
+// NamePinyin returns the toneless pinyin of name and the initials of its
+// words, both lowercase and without separators: "张三" gives "zhangsan" and
+// "zs". Latin words are kept, so "Alice 王" gives "alicewang" and "aw".
+// Polyphonic characters use their most common reading.
+func NamePinyin(name string) (full, initials string) {
+	var fullBuf, initialsBuf strings.Builder
+	wordStart := true
+
+	for _, r := range name {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			readings := pinyin.SinglePinyin(r, pinyinArgs)
+			if len(readings) == 0 || readings[0] == "" {
+				wordStart = true
+				continue
+			}
+			fullBuf.WriteString(readings[0])
+			initialsBuf.WriteByte(readings[0][0])
+			wordStart = true
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			r = unicode.ToLower(r)
+			fullBuf.WriteRune(r)
+			if wordStart {
+				initialsBuf.WriteRune(r)
+			}
+			wordStart = false
+		default:
+			wordStart = true
+		}
+	}
+
+	return fullBuf.String(), initialsBuf.String()
+}
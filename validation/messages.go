@@ -0,0 +1,160 @@
+package validation
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	LangEnglish = "en"
+	LangChinese = "zh-CN"
+)
+
+// messages holds the templates for each language, keyed by validation tag.
+// {field} is replaced by the field label and {param} by the tag parameter.
+// Tags that behave differently for strings have a "_string" variant. Codes of
+// checks made by the services, such as the password policy, are listed after
+// the validator tags.
+var messages = map[string]map[string]string{
+	LangEnglish: {
+		"required":   "{field} is required",
+		"email":      "{field} must be a valid email address",
+		"min":        "{field} must be at least {param}",
+		"min_string": "{field} must be at least {param} characters",
+		"max":        "{field} must be at most {param}",
+		"max_string": "{field} must be at most {param} characters",
+		"gte":        "{field} must be greater than or equal to {param}",
+		"lte":        "{field} must be less than or equal to {param}",
+		"oneof":      "{field} must be one of [{param}]",
+		"phone":      "{field} must be a valid mobile phone number",
+		"age":        "{field} must be between " + strconv.Itoa(MinAge) + " and " + strconv.Itoa(MaxAge),
+		"format":     "{field} has an invalid format",
+		"json":       "row is not a valid JSON object",
+		"columns":    "row does not have the same number of columns as the header",
+		"duplicate":  "{field} already appears on line {param}",
+		"exists":     "{field} already exists",
+
+		"password_length":    "{field} must be at least {param} characters",
+		"password_max_bytes": "{field} must be at most {param} bytes",
+		"password_lower":     "{field} must contain a lowercase letter",
+		"password_upper":     "{field} must contain an uppercase letter",
+		"password_digit":     "{field} must contain a digit",
+		"password_symbol":    "{field} must contain a symbol",
+		"password_personal":  "{field} must not contain your name or email",
+		"password_common":    "{field} is too common",
+		"password_reused":    "{field} must not be one of your last {param} passwords",
+
+		"": "{field} is invalid",
+	},
+	LangChinese: {
+		"required":   "{field}不能为空",
+		"email":      "{field}必须是有效的邮箱地址",
+		"min":        "{field}不能小于{param}",
+		"min_string": "{field}长度不能少于{param}个字符",
+		"max":        "{field}不能大于{param}",
+		"max_string": "{field}长度不能超过{param}个字符",
+		"gte":        "{field}必须大于或等于{param}",
+		"lte":        "{field}必须小于或等于{param}",
+		"oneof":      "{field}必须是[{param}]中的一个",
+		"phone":      "{field}必须是有效的手机号码",
+		"age":        "{field}必须在" + strconv.Itoa(MinAge) + "到" + strconv.Itoa(MaxAge) + "之间",
+		"format":     "{field}格式不正确",
+		"json":       "该行不是有效的 JSON 对象",
+		"columns":    "该行的列数与表头不一致",
+		"duplicate":  "{field}与第{param}行重复",
+		"exists":     "{field}已被使用",
+
+		"password_length":    "{field}长度不能少于{param}个字符",
+		"password_max_bytes": "{field}不能超过{param}个字节",
+		"password_lower":     "{field}必须包含小写字母",
+		"password_upper":     "{field}必须包含大写字母",
+		"password_digit":     "{field}必须包含数字",
+		"password_symbol":    "{field}必须包含符号",
+		"password_personal":  "{field}不能包含姓名或邮箱",
+		"password_common":    "{field}过于常见",
+		"password_reused":    "{field}不能与最近{param}次使用的密码相同",
+
+		"": "{field}格式不正确",
+	},
+}
+
+// labels names request fields in messages. Fields without a label use their
+// JSON name.
+var labels = map[string]map[string]string{
+	LangChinese: {
+		"name":          "姓名",
+		"email":         "邮箱",
+		"password":      "密码",
+		"phone":         "手机号",
+		"age":           "年龄",
+		"status":        "状态",
+		"old_password":  "原密码",
+		"new_password":  "新密码",
+		"refresh_token": "刷新令牌",
+		"role":          "角色",
+	},
+}
+
+func message(lang string, fe validator.FieldError) string {
+	return render(lang, fe.Tag(), fe.Kind() == reflect.String, fe.Field(), fe.Param())
+}
+
+func render(lang, code string, isString bool, field, param string) string {
+	templates := messages[lang]
+
+	tmpl, ok := "", false
+	if isString {
+		tmpl, ok = templates[code+"_string"]
+	}
+	if !ok {
+		tmpl, ok = templates[code]
+	}
+	if !ok {
+		tmpl = templates[""]
+	}
+
+	if label, ok := labels[lang][field]; ok {
+		field = label
+	}
+	return strings.NewReplacer("{field}", field, "{param}", param).Replace(tmpl)
+}
+
+// Negotiate picks the supported language the Accept-Language header prefers
+// most, defaulting to English.
+func Negotiate(acceptLanguage string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		switch primary {
+		case "zh":
+			candidates = append(candidates, candidate{LangChinese, q})
+		case "en":
+			candidates = append(candidates, candidate{LangEnglish, q})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	if len(candidates) == 0 || candidates[0].q <= 0 {
+		return LangEnglish
+	}
+	return candidates[0].lang
+}
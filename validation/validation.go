@@ -0,0 +1,117 @@
+// Package validation registers the custom binding validators and turns
+// validator errors into localized, per-field messages.
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	MinAge = 0
+	MaxAge = 150
+)
+
+// phonePattern matches mainland China mobile numbers.
+var phonePattern = regexp.MustCompile(`^1[3-9]\d{9}$`)
+
+// FieldError describes why one request field failed validation. Code is the
+// validation rule that failed, such as "required" or "phone", and Param its
+// parameter, such as a minimum length.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   string `json:"-"`
+}
+
+// Register adds the custom validators to gin's binding validator and makes
+// it report fields by their JSON or query parameter names. It must run before any request is
+// bound.
+func Register() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("unexpected binding validator engine")
+	}
+
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, key := range []string{"json", "form"} {
+			name, _, _ := strings.Cut(field.Tag.Get(key), ",")
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return field.Name
+	})
+
+	if err := v.RegisterValidation("phone", validatePhone); err != nil {
+		return err
+	}
+	return v.RegisterValidation("age", validateAge)
+}
+
+// validatePhone accepts an empty value, since phone is optional and clearing
+// it must remain possible.
+func validatePhone(fl validator.FieldLevel) bool {
+	phone := fl.Field().String()
+	return phone == "" || phonePattern.MatchString(phone)
+}
+
+func validateAge(fl validator.FieldLevel) bool {
+	age := fl.Field().Int()
+	return age >= MinAge && age <= MaxAge
+}
+
+// Translate returns the field errors in err localized for the client's
+// Accept-Language header, or nil when err is not a validation failure.
+func Translate(err error, acceptLanguage string) []FieldError {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil
+	}
+
+	lang := Negotiate(acceptLanguage)
+	fieldErrs := make([]FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		fieldErrs = append(fieldErrs, FieldError{
+			Field:   fe.Field(),
+			Code:    fe.Tag(),
+			Message: message(lang, fe),
+		})
+	}
+	return fieldErrs
+}
+
+// Localize fills in the messages of field errors that have none, such as
+// those returned by the services, in the language the Accept-Language header
+// prefers.
+func Localize(fieldErrs []FieldError, acceptLanguage string) []FieldError {
+	lang := Negotiate(acceptLanguage)
+	localized := make([]FieldError, len(fieldErrs))
+	for i, fe := range fieldErrs {
+		if fe.Message == "" {
+			fe.Message = render(lang, fe.Code, false, fe.Field, fe.Param)
+		}
+		localized[i] = fe
+	}
+	return localized
+}
+
+// NewFieldError returns a localized error for a check made outside the
+// validator, such as a value that could not be parsed. Field may be empty
+// when the error concerns a whole record.
+func NewFieldError(acceptLanguage, field, code string) FieldError {
+	return FieldError{
+		Field:   field,
+		Code:    code,
+		Message: render(Negotiate(acceptLanguage), code, false, field, ""),
+	}
+}